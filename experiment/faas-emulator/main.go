@@ -0,0 +1,232 @@
+// Local stand-in of the FaaS platform used on the measurements. It receives
+// the function requests, spawns one worker process per concurrent request on
+// demand (cold start), keeps idle workers warm until the idleness deadline
+// and sheds requests with 503 when no worker can be started. Responses have
+// the JSON body shape the workload parses, so the workload and the simulator
+// can be validated against each other on one machine:
+//
+//	go run ../faas-emulator --addr=:8080 --worker_cmd="java -jar handler.jar"
+//	go run ../workload --target=http://localhost:8080/ ...
+//
+// Workers are started with the PORT environment variable set to the port they
+// must listen on. The synthetic function of function/synthetic-func is such a
+// worker, with a configurable service time and GC unavailability:
+//
+//	go build -o synthetic-func ../../function/synthetic-func
+//	go run ../faas-emulator --worker_cmd="./synthetic-func --init_time=1s"
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var (
+	addr             = flag.String("addr", ":8080", "address the platform front end listens on")
+	workerCmd        = flag.String("worker_cmd", "", "command line that starts a worker process listening on $PORT, e.g. the synthetic function of function/synthetic-func. There's no default value")
+	idlenessDeadline = flag.Duration("idleness", 300*time.Second, "The idleness deadline is the time that a worker may be idle until be terminated.")
+	maxWorkers       = flag.Int("max_workers", 0, "maximum number of live workers, requests that find all of them busy are shed with 503. Zero means no limit")
+	coldStartDelay   = flag.Duration("cold_start", 0, "extra delay added to the start of every worker, on top of the process start up")
+	startTimeout     = flag.Duration("start_timeout", 30*time.Second, "time a worker has to start listening before its request fails")
+	requestTimeout   = flag.Duration("timeout", 60*time.Second, "timeout of the requests forwarded to the workers")
+)
+
+func main() {
+	flag.Parse()
+
+	cmd, err := workerCommand(*workerCmd)
+	if err != nil {
+		log.Fatalf("invalid flags: %v", err)
+	}
+	p := newPlatform(cmd, *idlenessDeadline, *maxWorkers, *coldStartDelay, *startTimeout, *requestTimeout)
+	srv := &http.Server{Addr: *addr, Handler: p}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go p.reap(ctx)
+	go func() {
+		<-ctx.Done()
+		srv.Shutdown(context.Background())
+	}()
+
+	fmt.Printf("PLATFORM LISTENING ON %s\n", *addr)
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	p.terminateAll()
+	fmt.Println("PLATFORM TERMINATED")
+}
+
+var errNoCapacity = errors.New("all workers are busy and no new worker can be started")
+
+// platform is the front end. Like on the simulator, each worker serves one
+// request at a time and requests go to the most recently used idle worker.
+type platform struct {
+	cmd            []string
+	idleness       time.Duration
+	maxWorkers     int
+	coldStartDelay time.Duration
+	startTimeout   time.Duration
+	client         *http.Client
+
+	mu      sync.Mutex
+	workers []*worker
+	nextID  int
+}
+
+func newPlatform(cmd []string, idleness time.Duration, maxWorkers int, coldStartDelay, startTimeout, requestTimeout time.Duration) *platform {
+	return &platform{
+		cmd:            cmd,
+		idleness:       idleness,
+		maxWorkers:     maxWorkers,
+		coldStartDelay: coldStartDelay,
+		startTimeout:   startTimeout,
+		client:         &http.Client{Timeout: requestTimeout},
+	}
+}
+
+// acquire returns an idle worker marked as busy, starting a new one if there
+// is none. The boolean tells whether the worker was cold started.
+func (p *platform) acquire() (*worker, bool, error) {
+	p.mu.Lock()
+	var selected *worker
+	for _, w := range p.workers {
+		if !w.busy && (selected == nil || w.lastWorked.After(selected.lastWorked)) {
+			selected = w
+		}
+	}
+	if selected != nil {
+		selected.busy = true
+		p.mu.Unlock()
+		return selected, false, nil
+	}
+	if p.maxWorkers > 0 && len(p.workers) >= p.maxWorkers {
+		p.mu.Unlock()
+		return nil, false, errNoCapacity
+	}
+	w := &worker{id: fmt.Sprintf("w%d", p.nextID), busy: true}
+	p.nextID++
+	p.workers = append(p.workers, w)
+	p.mu.Unlock()
+
+	if err := w.start(p.cmd, p.coldStartDelay, p.startTimeout); err != nil {
+		p.remove(w)
+		return nil, false, err
+	}
+	return w, true, nil
+}
+
+func (p *platform) release(w *worker) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	w.busy = false
+	w.lastWorked = time.Now()
+}
+
+func (p *platform) remove(w *worker) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, o := range p.workers {
+		if o == w {
+			p.workers = append(p.workers[:i], p.workers[i+1:]...)
+			return
+		}
+	}
+}
+
+// reap terminates, every second, the workers idle for longer than the
+// idleness deadline.
+func (p *platform) reap(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		p.reapIdle()
+	}
+}
+
+func (p *platform) reapIdle() {
+	var idle []*worker
+	p.mu.Lock()
+	live := p.workers[:0]
+	for _, w := range p.workers {
+		if !w.busy && time.Since(w.lastWorked) >= p.idleness {
+			idle = append(idle, w)
+		} else {
+			live = append(live, w)
+		}
+	}
+	p.workers = live
+	p.mu.Unlock()
+	for _, w := range idle {
+		w.terminate()
+		fmt.Printf("WORKER %s TERMINATED AFTER %d REQUESTS\n", w.id, w.served)
+	}
+}
+
+func (p *platform) terminateAll() {
+	p.mu.Lock()
+	workers := p.workers
+	p.workers = nil
+	p.mu.Unlock()
+	for _, w := range workers {
+		w.terminate()
+	}
+}
+
+func (p *platform) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		writeResponse(rw, http.StatusBadRequest, map[string]interface{}{"message": err.Error()})
+		return
+	}
+	w, cold, err := p.acquire()
+	if err != nil {
+		// Shed responses have the same shape as the function ones, with an
+		// empty message as there is no service time to report.
+		status := http.StatusServiceUnavailable
+		if err != errNoCapacity {
+			log.Printf("Error starting worker: %v", err)
+			status = http.StatusBadGateway
+		}
+		writeResponse(rw, status, map[string]interface{}{"message": ""})
+		return
+	}
+	status, msg, err := w.forward(p.client, req, body)
+	p.release(w)
+	if err != nil {
+		log.Printf("Error forwarding request to worker %s: %v", w.id, err)
+		writeResponse(rw, http.StatusBadGateway, map[string]interface{}{"message": "", "container_id": w.id, "cold_start": cold})
+		return
+	}
+	msg["container_id"] = w.id
+	msg["cold_start"] = cold
+	writeResponse(rw, status, msg)
+}
+
+func writeResponse(rw http.ResponseWriter, status int, body map[string]interface{}) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	rw.Write(bytes.TrimSpace(b))
+}
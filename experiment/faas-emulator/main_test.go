@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestMain runs the test binary as a worker when the platform under test
+// starts it, so the tests need no function besides their own.
+func TestMain(m *testing.M) {
+	if os.Getenv("EMULATOR_TEST_WORKER") == "1" {
+		runTestWorker(os.Getenv("PORT"))
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// runTestWorker answers after the duration of the sleep query parameter, if
+// any, with a JSON message.
+func runTestWorker(port string) {
+	http.HandleFunc("/", func(rw http.ResponseWriter, req *http.Request) {
+		if d, err := time.ParseDuration(req.URL.Query().Get("sleep")); err == nil {
+			time.Sleep(d)
+		}
+		rw.Write([]byte(`{"message":"ok"}`))
+	})
+	http.ListenAndServe("127.0.0.1:"+port, nil)
+}
+
+// newTestPlatform returns a platform whose workers are the test binary, and
+// its front end server.
+func newTestPlatform(t *testing.T, idleness time.Duration, maxWorkers int) (*platform, *httptest.Server) {
+	t.Setenv("EMULATOR_TEST_WORKER", "1")
+	p := newPlatform([]string{os.Args[0]}, idleness, maxWorkers, 0, 10*time.Second, 10*time.Second)
+	srv := httptest.NewServer(p)
+	t.Cleanup(func() {
+		srv.Close()
+		p.terminateAll()
+	})
+	return p, srv
+}
+
+type testResponse struct {
+	status      int
+	message     string
+	containerID string
+	coldStart   bool
+}
+
+func get(t *testing.T, url string) testResponse {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Errorf("Unexpected error: %q", err)
+		return testResponse{}
+	}
+	defer resp.Body.Close()
+	var body struct {
+		Message     string `json:"message"`
+		ContainerID string `json:"container_id"`
+		ColdStart   bool   `json:"cold_start"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Errorf("Unexpected error: %q", err)
+	}
+	return testResponse{resp.StatusCode, body.Message, body.ContainerID, body.ColdStart}
+}
+
+func TestPlatform_ColdStartAndReuse(t *testing.T) {
+	_, srv := newTestPlatform(t, time.Minute, 0)
+	want := []testResponse{
+		{http.StatusOK, "ok", "w0", true},
+		{http.StatusOK, "ok", "w0", false},
+	}
+	for n, w := range want {
+		if got := get(t, srv.URL); got != w {
+			t.Fatalf("Want: %+v for request %d, got: %+v", w, n+1, got)
+		}
+	}
+}
+
+func TestPlatform_ConcurrentRequestsStartWorkers(t *testing.T) {
+	p, srv := newTestPlatform(t, time.Minute, 0)
+	var wg sync.WaitGroup
+	for n := 0; n < 2; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got := get(t, srv.URL+"/?sleep=200ms"); got.status != http.StatusOK || !got.coldStart {
+				t.Errorf("Want: a cold start, got: %+v", got)
+			}
+		}()
+	}
+	wg.Wait()
+	if len(p.workers) != 2 {
+		t.Fatalf("Want: 2 workers, got: %d", len(p.workers))
+	}
+	// The most recently used idle worker gets the next request.
+	p.workers[0].lastWorked = time.Now().Add(time.Second)
+	if got := get(t, srv.URL); got.containerID != p.workers[0].id || got.coldStart {
+		t.Fatalf("Want: a warm request to %s, got: %+v", p.workers[0].id, got)
+	}
+}
+
+// stopsListening tells whether the worker at url stops accepting connections
+// before the timeout.
+func stopsListening(url string, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		conn, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+		if err != nil {
+			return true
+		}
+		conn.Close()
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestPlatform_Reap(t *testing.T) {
+	p, srv := newTestPlatform(t, 100*time.Millisecond, 0)
+	if got := get(t, srv.URL); got.containerID != "w0" || !got.coldStart {
+		t.Fatalf("Want: a cold start on w0, got: %+v", got)
+	}
+	p.reapIdle()
+	if len(p.workers) != 1 {
+		t.Fatalf("Want: the worker kept before the idleness deadline, got %d workers", len(p.workers))
+	}
+	w := p.workers[0]
+	time.Sleep(100 * time.Millisecond)
+	p.reapIdle()
+	if len(p.workers) != 0 {
+		t.Fatalf("Want: the idle worker terminated, got %d workers", len(p.workers))
+	}
+	if !stopsListening(w.url, time.Second) {
+		t.Fatalf("Want: the worker process killed")
+	}
+	if got := get(t, srv.URL); got.containerID != "w1" || !got.coldStart {
+		t.Fatalf("Want: a cold start on w1 after reaping, got: %+v", got)
+	}
+}
+
+func TestPlatform_MaxWorkers(t *testing.T) {
+	_, srv := newTestPlatform(t, time.Minute, 1)
+	busy := make(chan testResponse)
+	go func() { busy <- get(t, srv.URL+"/?sleep=500ms") }()
+	// Waits for the first request to get the only worker.
+	time.Sleep(200 * time.Millisecond)
+	if got := get(t, srv.URL); got.status != http.StatusServiceUnavailable || got.message != "" {
+		t.Fatalf("Want: 503 with an empty message, got: %+v", got)
+	}
+	if got := <-busy; got.status != http.StatusOK {
+		t.Fatalf("Want: 200 for the request holding the worker, got: %+v", got)
+	}
+	if got := get(t, srv.URL); got.status != http.StatusOK || got.coldStart {
+		t.Fatalf("Want: the released worker reused, got: %+v", got)
+	}
+}
+
+func TestPlatform_StartFailure(t *testing.T) {
+	p := newPlatform([]string{"/nonexistent/worker"}, time.Minute, 0, 0, time.Second, time.Second)
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+	if got := get(t, srv.URL); got.status != http.StatusBadGateway {
+		t.Fatalf("Want: 502, got: %+v", got)
+	}
+	if len(p.workers) != 0 {
+		t.Fatalf("Want: the failed worker removed, got %d workers", len(p.workers))
+	}
+}
+
+func TestWorkerCommand(t *testing.T) {
+	got, err := workerCommand("  ./synthetic-func  --init_time=1s ")
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	if len(got) != 2 || got[0] != "./synthetic-func" || got[1] != "--init_time=1s" {
+		t.Fatalf("Want: [./synthetic-func --init_time=1s], got: %v", got)
+	}
+	if _, err := workerCommand(" "); err == nil {
+		t.Fatalf("Want error without a worker command")
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// workerCommand splits the worker command line.
+func workerCommand(cmdLine string) ([]string, error) {
+	cmd := strings.Fields(cmdLine)
+	if len(cmd) == 0 {
+		return nil, fmt.Errorf("worker_cmd must be set, e.g. to the synthetic function of function/synthetic-func")
+	}
+	return cmd, nil
+}
+
+// worker is one process serving the function, which plays the role of an
+// instance on the simulator. Its fields are protected by the platform mutex,
+// except cmd and url that are only written before the worker is shared.
+type worker struct {
+	id         string
+	cmd        *exec.Cmd
+	url        string
+	busy       bool
+	lastWorked time.Time
+	served     int64
+}
+
+// start runs the worker process and waits until it accepts connections.
+func (w *worker) start(cmdLine []string, coldStartDelay, timeout time.Duration) error {
+	port, err := freePort()
+	if err != nil {
+		return err
+	}
+	w.cmd = exec.Command(cmdLine[0], cmdLine[1:]...)
+	w.cmd.Env = append(os.Environ(), "PORT="+strconv.Itoa(port))
+	w.cmd.Stdout = os.Stderr
+	w.cmd.Stderr = os.Stderr
+	w.url = fmt.Sprintf("http://127.0.0.1:%d", port)
+	if err := w.cmd.Start(); err != nil {
+		return fmt.Errorf("could not start worker %s: %v", w.id, err)
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- w.cmd.Wait() }()
+	time.Sleep(coldStartDelay)
+
+	deadline := time.Now().Add(timeout)
+	for {
+		conn, err := net.DialTimeout("tcp", strings.TrimPrefix(w.url, "http://"), 100*time.Millisecond)
+		if err == nil {
+			conn.Close()
+			break
+		}
+		select {
+		case err := <-exited:
+			return fmt.Errorf("worker %s exited before listening: %v", w.id, err)
+		default:
+		}
+		if time.Now().After(deadline) {
+			w.cmd.Process.Kill()
+			return fmt.Errorf("worker %s did not listen on %s after %v", w.id, w.url, timeout)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	fmt.Printf("WORKER %s STARTED ON %s\n", w.id, w.url)
+	return nil
+}
+
+// forward sends the request to the worker and returns its status and JSON
+// body. Bodies which are not a JSON object become the message of one.
+func (w *worker) forward(client *http.Client, req *http.Request, body []byte) (int, map[string]interface{}, error) {
+	out, err := http.NewRequest(req.Method, w.url+req.URL.RequestURI(), bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	out.Header = req.Header.Clone()
+	resp, err := client.Do(out)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, err
+	}
+	w.served++
+	msg := make(map[string]interface{})
+	if err := json.Unmarshal(respBody, &msg); err != nil {
+		msg = map[string]interface{}{"message": string(respBody)}
+	}
+	return resp.StatusCode, msg, nil
+}
+
+func (w *worker) terminate() {
+	if w.cmd != nil && w.cmd.Process != nil {
+		w.cmd.Process.Kill()
+	}
+}
+
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, fmt.Errorf("could not find a free port for a worker: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
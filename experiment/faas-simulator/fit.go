@@ -0,0 +1,104 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/gcinterceptor/gci-simulator/serverless/sim"
+	"golang.org/x/exp/rand"
+)
+
+// familyBest picks, for each portion of the inputs, the parametric family with
+// the lowest AIC.
+const familyBest = "best"
+
+// runFit implements the fit command, which prints how well each distribution
+// family describes the cold start and warm service times of the inputs.
+func runFit(args []string) error {
+	fs := flag.NewFlagSet("fit", flag.ExitOnError)
+	inputs := fs.String("inputs", "default.csv", "Comma-separated file paths (one per instance)")
+	warmUpSpec := fs.String("warmup", "0", "Input entries after the cold start left out of the warm service times, as a number of entries or a duration of measured time")
+	fs.Parse(args)
+
+	warmUp, err := sim.ParseWarmUp(*warmUpSpec)
+	if err != nil {
+		return err
+	}
+	entries, err := readEntries(*inputs)
+	if err != nil {
+		return err
+	}
+	if entries, err = sim.DiscardWarmUp(entries, warmUp); err != nil {
+		return err
+	}
+	src := rand.NewSource(uint64(time.Now().Nanosecond()))
+	for _, portion := range []struct {
+		name    string
+		samples []float64
+	}{
+		{"COLD START", sim.ColdSamples(entries)},
+		{"WARM", sim.WarmSamples(entries)},
+	} {
+		report, err := sim.GoodnessOfFit(portion.samples, src)
+		if err != nil {
+			return fmt.Errorf("Error fitting the %s service times: %q", portion.name, err)
+		}
+		printFitReport(portion.name, report)
+	}
+	return nil
+}
+
+func printFitReport(name string, r sim.FitReport) {
+	st := r.Stats
+	fmt.Printf("%s SERVICE TIMES: n: %d, mean: %.6fs, sd: %.6fs, square of skewness: %.4f, kurtosis: %.4f\n",
+		name, st.N, st.Mean, st.StdDev, st.Skewness*st.Skewness, st.Kurtosis)
+	fmt.Printf("  %-10s %14s %14s %8s  %s\n", "family", "loglikelihood", "AIC", "KS", "parameters")
+	for _, f := range r.Fits {
+		fmt.Printf("  %-10s %14.2f %14.2f %8.4f  %s\n", f.Family, f.LogLikelihood, f.AIC, f.KS, sim.DescribeDistribution(f.Dist))
+	}
+}
+
+// buildServiceTimeModel builds the service time model of the simulation from
+// the service_model, cold_dist and warm_dist flags and the inputs without their
+// warm up. A portion of the inputs with a single sample, too few to fit, keeps
+// its recorded service time. It returns nil if the inputs must be replayed
+// instead.
+func buildServiceTimeModel(family, coldSpec, warmSpec string, entries [][]sim.InputEntry) (*sim.ServiceTimeModel, error) {
+	if family == "" && coldSpec == "" && warmSpec == "" {
+		return nil, nil
+	}
+	if family == "" && (coldSpec == "" || warmSpec == "") {
+		return nil, fmt.Errorf("Both cold_dist and warm_dist must be set, unless service_model is set to fit the other")
+	}
+	src := rand.NewSource(uint64(time.Now().Nanosecond()))
+	portion := func(spec string, samples []float64) (sim.Distribution, error) {
+		switch {
+		case spec != "":
+			return sim.ParseDistribution(spec, src)
+		case len(samples) == 1:
+			// e.g. the cold start of a single input file, which is replayed
+			// as recorded as it can not be fitted.
+			return sim.NewRecordedDistribution(samples[0]), nil
+		case family == familyBest:
+			report, err := sim.GoodnessOfFit(samples, src)
+			if err != nil {
+				return nil, err
+			}
+			return report.Fits[0].Dist, nil
+		default:
+			return sim.Fit(family, samples, src)
+		}
+	}
+	cold, err := portion(coldSpec, sim.ColdSamples(entries))
+	if err != nil {
+		return nil, fmt.Errorf("Error building the cold start distribution: %q", err)
+	}
+	warm, err := portion(warmSpec, sim.WarmSamples(entries))
+	if err != nil {
+		return nil, fmt.Errorf("Error building the warm service time distribution: %q", err)
+	}
+	shed, shedRate := sim.ShedEntries(entries)
+	fmt.Printf("SERVICE TIME MODEL, COLD START: %s, WARM: %s, SHED RATE: %.4f\n", sim.DescribeDistribution(cold), sim.DescribeDistribution(warm), shedRate)
+	return sim.NewServiceTimeModel(cold, warm, shedRate, shed, src), nil
+}
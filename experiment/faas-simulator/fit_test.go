@@ -0,0 +1,22 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gcinterceptor/gci-simulator/serverless/sim"
+)
+
+func TestBuildServiceTimeModel_SingleInput(t *testing.T) {
+	entries := [][]sim.InputEntry{{{200, 5, "", 0, 0}, {200, 0.2, "", 0, 0}, {200, 0.3, "", 0, 0}, {200, 0.25, "", 0, 0}}}
+	m, err := buildServiceTimeModel("lognormal", "", "", entries)
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	if got := sim.DescribeDistribution(m.Cold); got != "recorded(5)" {
+		t.Fatalf("Want: the recorded cold start, got: %s", got)
+	}
+	if got := sim.DescribeDistribution(m.Warm); !strings.HasPrefix(got, "lognormal:") {
+		t.Fatalf("Want: a fitted lognormal warm distribution, got: %s", got)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gcinterceptor/gci-simulator/serverless/sim"
+)
+
+// functionSpec is one of the functions of the file given by the functions
+// flag.
+type functionSpec struct {
+	Name     string  `json:"name"`
+	Inputs   string  `json:"inputs"`    // comma-separated file paths (one per instance)
+	Lambda   float64 `json:"lambda"`    // of the Poisson distribution of the function workload
+	MemoryMB int     `json:"memory_mb"` // memory of each instance
+	CPUs     float64 `json:"cpus"`      // CPUs of each instance
+	Idleness string  `json:"idleness"`  // idleness deadline of the instances, e.g. "300s"
+}
+
+// readFunctions reads the functions of a multi-function simulation. The lambda,
+// idleness, memory and CPUs of the functions default to the given ones, and
+// their inputs are validated against the warm up.
+func readFunctions(path string, lambda float64, idleness time.Duration, memoryMB int, cpus float64, warmUp sim.WarmUp) ([]sim.Function, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading the functions file (%s): %q", path, err)
+	}
+	var specs []functionSpec
+	if err := json.Unmarshal(b, &specs); err != nil {
+		return nil, fmt.Errorf("Error parsing the functions file (%s): %q", path, err)
+	}
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("The functions file (%s) has no function", path)
+	}
+	var functions []sim.Function
+	for _, spec := range specs {
+		f := sim.Function{Name: spec.Name, MemoryMB: memoryMB, CPUs: cpus, IdlenessDeadline: idleness}
+		if spec.MemoryMB > 0 {
+			f.MemoryMB = spec.MemoryMB
+		}
+		if spec.CPUs > 0 {
+			f.CPUs = spec.CPUs
+		}
+		if spec.Idleness != "" {
+			if f.IdlenessDeadline, err = time.ParseDuration(spec.Idleness); err != nil {
+				return nil, fmt.Errorf("Error parsing the idleness of function %s: %q", spec.Name, err)
+			}
+		}
+		l := lambda
+		if spec.Lambda > 0 {
+			l = spec.Lambda
+		}
+		f.InterArrival = sim.NewPoissonInterArrival(l)
+		if spec.Inputs == "" {
+			return nil, fmt.Errorf("Function %s has no inputs", spec.Name)
+		}
+		if f.Entries, err = readEntries(spec.Inputs); err != nil {
+			return nil, err
+		}
+		if _, err := sim.DiscardWarmUp(f.Entries, warmUp); err != nil {
+			return nil, fmt.Errorf("Error validating the inputs of function %s: %q", spec.Name, err)
+		}
+		functions = append(functions, f)
+	}
+	return functions, nil
+}
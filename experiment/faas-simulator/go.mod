@@ -1,9 +1,18 @@
 module github.com/gcinterceptor/gci-simulator/serverless
 
-go 1.12
+go 1.22
 
 require (
 	github.com/agoussia/godes v0.0.0-20180605170806-4952b44f646a
+	github.com/parquet-go/parquet-go v0.25.1
 	golang.org/x/exp v0.0.0-20190918111812-0cae2de268ce
 	gonum.org/v1/gonum v0.0.0-20190915125329-975d99cd20a9
 )
+
+require (
+	github.com/andybalholm/brotli v1.1.0 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/klauspost/compress v1.17.9 // indirect
+	github.com/pierrec/lz4/v4 v4.1.21 // indirect
+	golang.org/x/sys v0.21.0 // indirect
+)
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gcinterceptor/gci-simulator/serverless/sim"
+)
+
+// maxIssuesPrinted bounds the issues printed per input file.
+const maxIssuesPrinted = 10
+
+// inputProfile packs the statistics of one input file. Times are in seconds.
+type inputProfile struct {
+	Rows            int
+	ColdStart       float64   // response time of the first entry
+	Warm            int       // successful entries after the cold start
+	WarmMean        float64   // mean of the warm response times
+	WarmPercentiles []float64 // warm response times at inspectPercentiles
+	ShedRate        float64   // fraction of entries with status 503
+	ShedWindows     []float64 // tsafter - tsbefore of the 503 entries
+	Autocorrelation []float64 // of the warm response times, at lags 1, 2 and 3
+}
+
+var inspectPercentiles = []float64{50, 90, 95, 99, 99.9}
+
+// runInspect implements the inspect command, which validates input files and
+// prints their statistics. It fails if any file has an issue, so it can be run
+// before a long simulation.
+func runInspect(args []string) error {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	inputs := fs.String("inputs", "default.csv", "Comma-separated file paths (one per instance)")
+	fs.Parse(args)
+
+	invalid := 0
+	for _, p := range strings.Split(*inputs, ",") {
+		prof, issues, err := inspectFile(p)
+		if err != nil {
+			return err
+		}
+		printProfile(p, prof)
+		if len(issues) > 0 {
+			invalid++
+			fmt.Printf("  %d ISSUES:\n", len(issues))
+			for i, issue := range issues {
+				if i == maxIssuesPrinted {
+					fmt.Printf("    ... and %d more\n", len(issues)-maxIssuesPrinted)
+					break
+				}
+				fmt.Printf("    %s\n", issue)
+			}
+		}
+	}
+	if invalid > 0 {
+		return fmt.Errorf("%d input files have issues", invalid)
+	}
+	fmt.Println("ALL INPUTS ARE VALID")
+	return nil
+}
+
+// inspectFile reads and validates one input file. Rows that can not be parsed
+// are reported as issues, while errors reading the file are returned.
+func inspectFile(p string) (inputProfile, []string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return inputProfile{}, nil, fmt.Errorf("Error opening the file (%s), %q", p, err)
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return inputProfile{}, nil, fmt.Errorf("Error parsing csv (%s): %q", p, err)
+	}
+	if len(records) <= 1 {
+		return inputProfile{}, []string{"no requests (empty or header-only input file)"}, nil
+	}
+
+	coldIdx := -1
+	for i, h := range records[0] {
+		if h == "cold_start" {
+			coldIdx = i
+		}
+	}
+	var issues []string
+	var entries []sim.InputEntry
+	var coldRows []int
+	for n, row := range records[1:] {
+		line := n + 2
+		if len(row) < len(inputColumns) {
+			issues = append(issues, fmt.Sprintf("line %d: %d columns, want at least %d", line, len(row), len(inputColumns)))
+			continue
+		}
+		e, err := toEntry(row)
+		if err != nil {
+			issues = append(issues, fmt.Sprintf("line %d: %v", line, err))
+			continue
+		}
+		if coldIdx >= 0 && coldIdx < len(row) && row[coldIdx] == "true" {
+			coldRows = append(coldRows, len(entries))
+		}
+		entries = append(entries, e)
+		for _, issue := range validateEntry(e) {
+			issues = append(issues, fmt.Sprintf("line %d: %s", line, issue))
+		}
+	}
+	if coldIdx >= 0 && (len(coldRows) != 1 || coldRows[0] != 0) {
+		issues = append(issues, fmt.Sprintf("cold_start column flags entries %v, want only the first one", coldRows))
+	}
+	if len(entries) > 0 && entries[0].Status != 200 {
+		issues = append(issues, fmt.Sprintf("first entry has status %d, the cold start must succeed", entries[0].Status))
+	}
+	return profileEntries(entries), issues, nil
+}
+
+// validateEntry returns the issues of one entry.
+func validateEntry(e sim.InputEntry) []string {
+	var issues []string
+	if e.Status != 200 && e.Status != 503 {
+		issues = append(issues, fmt.Sprintf("status %d, want 200 or 503", e.Status))
+	}
+	if e.ResponseTime < 0 {
+		issues = append(issues, fmt.Sprintf("negative response time %f", e.ResponseTime))
+	}
+	if e.TsAfter < e.TsBefore {
+		issues = append(issues, fmt.Sprintf("tsafter %f before tsbefore %f", e.TsAfter, e.TsBefore))
+	}
+	if e.Status == 503 {
+		// The body holds the shed response times separated by ':', of which the
+		// simulator skips the first.
+		if e.Body == "" {
+			issues = append(issues, "503 entry has an empty body")
+		}
+		for _, s := range strings.Split(e.Body, ":")[1:] {
+			rt, err := strconv.ParseFloat(s, 64)
+			if err != nil || rt < 0 {
+				issues = append(issues, fmt.Sprintf("503 body %q has invalid shed response time %q", e.Body, s))
+				break
+			}
+		}
+	}
+	return issues
+}
+
+// profileEntries computes the statistics of the entries. The first entry is
+// taken as the cold start, as the simulator does.
+func profileEntries(entries []sim.InputEntry) inputProfile {
+	prof := inputProfile{Rows: len(entries)}
+	if len(entries) == 0 {
+		return prof
+	}
+	prof.ColdStart = entries[0].ResponseTime
+	var warm []float64
+	shed := 0
+	for i, e := range entries {
+		switch {
+		case e.Status == 503:
+			shed++
+			prof.ShedWindows = append(prof.ShedWindows, tsDiffSeconds(e.TsBefore, e.TsAfter))
+		case e.Status == 200 && i > 0:
+			warm = append(warm, e.ResponseTime)
+		}
+	}
+	prof.ShedRate = float64(shed) / float64(len(entries))
+	prof.Warm = len(warm)
+	if len(warm) == 0 {
+		return prof
+	}
+	prof.WarmMean = mean(warm)
+	for lag := 1; lag <= 3; lag++ {
+		prof.Autocorrelation = append(prof.Autocorrelation, autocorrelation(warm, prof.WarmMean, lag))
+	}
+	sorted := append([]float64(nil), warm...)
+	sort.Float64s(sorted)
+	for _, q := range inspectPercentiles {
+		prof.WarmPercentiles = append(prof.WarmPercentiles, percentile(sorted, q))
+	}
+	return prof
+}
+
+// tsDiffSeconds returns the time between two timestamps in seconds. The
+// workload writes them in nanoseconds since the epoch, while older inputs have
+// them in seconds.
+func tsDiffSeconds(before, after float64) float64 {
+	if before > 1e15 {
+		return (after - before) / 1e9
+	}
+	return after - before
+}
+
+func mean(v []float64) float64 {
+	sum := 0.0
+	for _, x := range v {
+		sum += x
+	}
+	return sum / float64(len(v))
+}
+
+// percentile returns the nearest-rank p-th percentile of sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+// autocorrelation returns the sample autocorrelation of v at the given lag,
+// which is NaN if there are not enough values or they do not vary.
+func autocorrelation(v []float64, m float64, lag int) float64 {
+	if lag >= len(v) {
+		return math.NaN()
+	}
+	var num, den float64
+	for i, x := range v {
+		den += (x - m) * (x - m)
+		if i+lag < len(v) {
+			num += (x - m) * (v[i+lag] - m)
+		}
+	}
+	if den == 0 {
+		return math.NaN()
+	}
+	return num / den
+}
+
+func printProfile(p string, prof inputProfile) {
+	fmt.Printf("%s: %d entries, cold start: %.6fs, 503 rate: %.4f\n", p, prof.Rows, prof.ColdStart, prof.ShedRate)
+	if prof.Warm > 0 {
+		var ps []string
+		for i, q := range inspectPercentiles {
+			ps = append(ps, fmt.Sprintf("p%v: %.6fs", q, prof.WarmPercentiles[i]))
+		}
+		fmt.Printf("  warm: %d entries, mean: %.6fs, %s\n", prof.Warm, prof.WarmMean, strings.Join(ps, ", "))
+		fmt.Printf("  warm autocorrelation, lag 1: %.4f, lag 2: %.4f, lag 3: %.4f\n", prof.Autocorrelation[0], prof.Autocorrelation[1], prof.Autocorrelation[2])
+	}
+	if len(prof.ShedWindows) > 0 {
+		sorted := append([]float64(nil), prof.ShedWindows...)
+		sort.Float64s(sorted)
+		fmt.Printf("  shed windows: %d, mean: %.6fs, p50: %.6fs, max: %.6fs\n", len(sorted), mean(sorted), percentile(sorted, 50), sorted[len(sorted)-1])
+	}
+}
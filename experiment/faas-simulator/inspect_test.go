@@ -0,0 +1,78 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/gcinterceptor/gci-simulator/serverless/sim"
+)
+
+func TestValidateEntry(t *testing.T) {
+	var testData = []struct {
+		desc   string
+		entry  sim.InputEntry
+		issues int
+	}{
+		{"Valid", sim.InputEntry{Status: 200, ResponseTime: 0.02, Body: "19000000", TsBefore: 1, TsAfter: 2}, 0},
+		{"ValidShed", sim.InputEntry{Status: 503, ResponseTime: 0.001, Body: "0.001:0.002", TsBefore: 1, TsAfter: 2}, 0},
+		{"UnknownStatus", sim.InputEntry{Status: 0, TsBefore: 1, TsAfter: 2}, 1},
+		{"NegativeResponseTime", sim.InputEntry{Status: 200, ResponseTime: -1, TsBefore: 1, TsAfter: 2}, 1},
+		{"TsAfterBeforeTsBefore", sim.InputEntry{Status: 200, TsBefore: 2, TsAfter: 1}, 1},
+		{"ShedWithoutFollowingTimes", sim.InputEntry{Status: 503, Body: "0.001", TsBefore: 1, TsAfter: 2}, 0},
+		{"EmptyShedBody", sim.InputEntry{Status: 503, TsBefore: 1, TsAfter: 2}, 1},
+		{"MalformedShed", sim.InputEntry{Status: 503, Body: "0.001:x:0.002", TsBefore: 1, TsAfter: 2}, 1},
+	}
+	for _, d := range testData {
+		t.Run(d.desc, func(t *testing.T) {
+			if got := validateEntry(d.entry); len(got) != d.issues {
+				t.Fatalf("Want: %d issues, got: %v", d.issues, got)
+			}
+		})
+	}
+}
+
+func TestProfileEntries(t *testing.T) {
+	entries := []sim.InputEntry{
+		{Status: 200, ResponseTime: 3},
+		{Status: 200, ResponseTime: 1},
+		{Status: 503, ResponseTime: 0.001, TsBefore: 1e18, TsAfter: 1e18 + 5e7},
+		{Status: 200, ResponseTime: 2},
+		{Status: 200, ResponseTime: 1},
+		{Status: 200, ResponseTime: 2},
+	}
+	prof := profileEntries(entries)
+	if prof.Rows != 6 || prof.ColdStart != 3 || prof.Warm != 4 || prof.WarmMean != 1.5 {
+		t.Fatalf("Want: 6 rows, cold start 3, 4 warm with mean 1.5, got: %+v", prof)
+	}
+	if want := []float64{1, 2, 2, 2, 2}; !reflect.DeepEqual(want, prof.WarmPercentiles) {
+		t.Fatalf("Want: %v, got: %v", want, prof.WarmPercentiles)
+	}
+	if math.Abs(prof.ShedRate-1.0/6) > 1e-9 || len(prof.ShedWindows) != 1 || math.Abs(prof.ShedWindows[0]-0.05) > 1e-9 {
+		t.Fatalf("Want: shed rate 1/6 and one 0.05s window, got: %v %v", prof.ShedRate, prof.ShedWindows)
+	}
+	// Warm series 1,2,1,2 alternates, so lag 1 is negative and lag 2 positive.
+	if prof.Autocorrelation[0] >= 0 || prof.Autocorrelation[1] <= 0 {
+		t.Fatalf("Want: negative lag 1 and positive lag 2 autocorrelation, got: %v", prof.Autocorrelation)
+	}
+}
+
+func TestInspectFile_ColdStartColumn(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "input.csv")
+	in := `id,status,response_time,body,tsbefore,tsafter,cold_start
+1,200,30000000,29000000,10,40,false
+2,200,5000000,4000000,48,53,true
+`
+	if err := os.WriteFile(p, []byte(in), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, issues, err := inspectFile(p)
+	if err != nil {
+		t.Fatalf("Error not expected: %q", err)
+	}
+	if len(issues) != 1 {
+		t.Fatalf("Want: 1 issue, got: %v", issues)
+	}
+}
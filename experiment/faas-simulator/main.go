@@ -1,14 +1,17 @@
 package main
 
 import (
+	"context"
 	"encoding/csv"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gcinterceptor/gci-simulator/serverless/sim"
@@ -21,36 +24,124 @@ var (
 	inputs           = flag.String("inputs", "default.csv", "Comma-separated file paths (one per instance)")
 	outputPath       = flag.String("output", "", "file path to output results")
 	scenario         = flag.String("scenario", "simoutput", "The scenario to compose the name of output file results")
-	scheduler        = flag.Int("scheduler", 0, "Define the scheduler used on simulation. 0 mean normal scheduler, 1 mean optimized scheduler and 2 mean optimized scheduler including GCI. The defaul value is 0")
-	warmUp           = flag.Int("warmup", 0, "The Warm Up value to remove , default value is 500")
+	scheduler        = flag.Int("scheduler", 0, "Define the scheduler used on simulation. 0 mean normal scheduler, 1 mean optimized scheduler, 2 mean optimized scheduler including GCI and 3 mean GC-aware scheduler, which avoids instances about to collect and is compared to a run of scheduler 2 on the same arrivals. The defaul value is 0")
+	gciThreshold     = flag.Float64("gci_threshold", sim.DefaultGCIThreshold, "Heap occupancy, as the fraction of its GC cycle an instance went through, from which the GC-aware scheduler avoids it")
+	warmUpSpec       = flag.String("warmup", "0", "Input entries measured while the function was warming up, discarded after the cold start. A number of entries (e.g. 500) or a duration of measured time (e.g. 30s)")
+	metricsWarmUp    = flag.Bool("warmup_metrics", false, "Discard the warm up from the simulated requests output and throughput instead of from the inputs: the first warmup requests or those arriving in the first warmup of simulated time. Instance cost and efficiency still cover the whole simulation")
+	outputFormat     = flag.String("format", formatCSV, "Format of the requests and instances output files: csv, jsonl or parquet")
+	gzipped          = flag.Bool("gzip", false, "Compress the requests and instances output files with gzip")
+	sampleEvery      = flag.Int64("sample_every", 1, "Write only every Nth finished request to the requests output file")
+	sampleNonTrivial = flag.Bool("sample_nontrivial", false, "Write only requests that hopped through more than one instance to the requests output file")
+	progress         = flag.Duration("progress", 10*time.Second, "Wall-clock interval between progress reports. Zero disables the reports")
+	timeout          = flag.Duration("timeout", 0, "Wall-clock time limit of the simulation. When reached, the partial results are saved. Zero means no limit")
+	tracePath        = flag.String("trace", "", "file path to save the simulation event trace in Chrome trace-event JSON format. No trace is saved by default")
+	serviceModel     = flag.String("service_model", "", "Distribution family fitted to the inputs and sampled instead of replaying them: lognormal, gamma, weibull, empirical or best (lowest AIC). With a single input file, its recorded cold start is kept. The inputs are replayed by default")
+	coldDist         = flag.String("cold_dist", "", "Cold start distribution given by its parameters, e.g. lognormal:MU:SIGMA, gamma:ALPHA:BETA or weibull:K:LAMBDA, overriding the fitted one")
+	warmDist         = flag.String("warm_dist", "", "Warm service time distribution given by its parameters, as cold_dist, overriding the fitted one")
+	replay           = flag.String("replay", "sequential", "Order in which the instances replay their warm input entries: sequential, offset (sequential from a random entry), bootstrap (random entries) or block (random GC cycles, or blocks of block_size entries if the inputs have no 503)")
+	blockSize        = flag.Int("block_size", 100, "Number of entries per block of the block replay when the inputs have no 503 entry")
+	dispatch         = flag.String("dispatch", "mru", "Rule picking the idle instance that receives a request: mru (most recently used), lru (least recently used), random, roundrobin, p2c (most recently used of two random ones) or pack (first-fit bin-packing, the oldest instance with idle time left until the idleness deadline first). Other than mru, it is appended to the scheduler name of the outputs")
+	functionsPath    = flag.String("functions", "", "JSON file with the functions to simulate instead of the single one given by inputs, lambda and idleness: a list of objects with name, inputs, lambda, memory_mb, cpus and idleness (e.g. \"300s\"), all but name and inputs defaulting to the flags")
+	concurrencyLimit = flag.Int("concurrency_limit", 0, "Live instances of all the functions, as an account-level concurrency limit. Requests needing an instance beyond it are throttled. Zero means no limit")
+	memoryPoolMB     = flag.Int("memory_pool_mb", 0, "Memory of the host pool the live instances of all the functions take, in MB. Requests needing an instance beyond it are throttled. Zero means no limit")
+	memoryMB         = flag.Int("memory_mb", 256, "Memory of each instance, in MB, taken from memory_pool_mb and its host. Default of the functions without memory_mb")
+	cpus             = flag.Float64("cpus", 1, "CPUs of each instance, taken from its host. Default of the functions without cpus")
+	hosts            = flag.Int("hosts", 0, "Number of hosts of the cluster the instances are placed on. Requests needing an instance no host has room for are throttled. Zero means no cluster")
+	hostMemoryMB     = flag.Int("host_memory_mb", 16384, "Memory of each host, in MB")
+	hostCPUs         = flag.Float64("host_cpus", 0, "CPUs of each host. Zero means the CPUs do not limit the instances placed")
+	placement        = flag.String("placement", "firstfit", "Rule picking the host of a new instance: firstfit, bestfit (the host left with the least free memory) or spread (the host with the most free memory)")
+	evict            = flag.Bool("evict", false, "Evict idle instances, least recently used first, to make room for new ones when no host has it")
+	snapshotRestore  = flag.String("snapshot_restore", "", "Restore latency distribution of a snapshot replacing the cold start of the instances not warmed by the scheduler, given by its parameters as cold_dist, e.g. lognormal:MU:SIGMA. The first input entry is replayed as the cold start by default")
+	snapshotPenalty  = flag.Float64("snapshot_penalty", 0, "Extra fraction of the response time of the first successful request after a restore, e.g. 0.5 for 50% slower, decaying linearly over snapshot_penalty_requests successful requests")
+	snapshotPenaltyN = flag.Int("snapshot_penalty_requests", 10, "Number of successful requests after a restore over which the snapshot_penalty decays")
+	snapshotSizeMB   = flag.Float64("snapshot_size_mb", 0, "Size of the snapshot of each function, in MB, stored during the whole simulation")
+	randomFiles      = flag.Bool("random_files", false, "Assign the input files to new instances at random instead of round-robin")
 )
 
+// commands are the tools run as the first argument of the simulator binary,
+// e.g. serverless split --input=measurement.csv. Without one, the simulation
+// is run.
+var commands = map[string]func(args []string) error{
+	"split":   runSplit,
+	"inspect": runInspect,
+	"fit":     runFit,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			if err := cmd(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
 	flag.Parse()
 
-	if len(*inputs) == 0 {
-		log.Fatalf("Must have at least one file input!")
+	switch *outputFormat {
+	case formatCSV, formatJSONL, formatParquet:
+	default:
+		log.Fatalf("Invalid output format (%s), must be csv, jsonl or parquet", *outputFormat)
+	}
+	replayStrategy, err := sim.ParseReplayStrategy(*replay)
+	if err != nil {
+		log.Fatal(err)
+	}
+	dispatchStrategy, err := sim.ParseDispatchStrategy(*dispatch)
+	if err != nil {
+		log.Fatal(err)
+	}
+	placementPolicy, err := sim.ParsePlacementPolicy(*placement)
+	if err != nil {
+		log.Fatal(err)
+	}
+	capacity := sim.Capacity{ConcurrencyLimit: *concurrencyLimit, MemoryMB: *memoryPoolMB, Placement: placementPolicy, Eviction: *evict}
+	for n := 0; n < *hosts; n++ {
+		capacity.Hosts = append(capacity.Hosts, sim.Host{MemoryMB: *hostMemoryMB, CPUs: *hostCPUs})
+	}
+	if *blockSize < 1 {
+		log.Fatalf("Invalid block size (%d), must be at least 1", *blockSize)
+	}
+	warmUp, err := sim.ParseWarmUp(*warmUpSpec)
+	if err != nil {
+		log.Fatal(err)
+	}
+	snapshot, err := buildSnapshotModel(*snapshotRestore, *snapshotPenalty, *snapshotPenaltyN, *snapshotSizeMB)
+	if err != nil {
+		log.Fatal(err)
 	}
-
 	var entries [][]sim.InputEntry
-	for _, p := range strings.Split(*inputs, ",") {
-		func() {
-			f, err := os.Open(p)
-			if err != nil {
-				log.Fatalf("Error opening the file (%s), %q", p, err)
-			}
-			defer f.Close()
-
-			records, err := readRecords(f, p)
-			if err != nil {
-				log.Fatalf("Error reading records: %q", err)
-			}
-			e, err := buildEntryArray(records)
-			if err != nil {
-				log.Fatalf("Error building entries %s. Error: %q", p, err)
-			}
-			entries = append(entries, e)
-		}()
+	var functions []sim.Function
+	var serviceTime *sim.ServiceTimeModel
+	if *functionsPath != "" {
+		if *serviceModel != "" || *coldDist != "" || *warmDist != "" {
+			log.Fatalf("The service_model, cold_dist and warm_dist flags are not supported with functions")
+		}
+		if functions, err = readFunctions(*functionsPath, *lambda, *idlenessDeadline, *memoryMB, *cpus, warmUp); err != nil {
+			log.Fatal(err)
+		}
+		for n := range functions {
+			functions[n].Snapshot = snapshot
+		}
+	} else {
+		if len(*inputs) == 0 {
+			log.Fatalf("Must have at least one file input!")
+		}
+		if entries, err = readEntries(*inputs); err != nil {
+			log.Fatal(err)
+		}
+		// The inputs are validated against the warm up even if it is discarded
+		// from the metrics, so a long simulation does not start with bad inputs.
+		warmEntries, err := sim.DiscardWarmUp(entries, warmUp)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *metricsWarmUp {
+			warmEntries = entries
+		}
+		if serviceTime, err = buildServiceTimeModel(*serviceModel, *coldDist, *warmDist, warmEntries); err != nil {
+			log.Fatal(err)
+		}
 	}
 	var schedulerName string
 	switch *scheduler {
@@ -58,19 +149,83 @@ func main() {
 		schedulerName = "-opscheduler"
 	case 2:
 		schedulerName = "-opgcischeduler"
+	case 3:
+		schedulerName = "-gcischeduler"
 	default:
 		schedulerName = "-normscheduler"
 	}
+	if dispatchStrategy != sim.DispatchMRU {
+		schedulerName += "-" + dispatchStrategy.String()
+	}
 	outputPathAndFileName := *outputPath + "sim-" + *scenario + schedulerName
-	outputReqsFilePath := outputPathAndFileName + "-reqs.csv"
-	header := "id,status,created_time,response_time,hops,responses\n"
-	reqsOutputWriter, err := newOutputWriter(outputReqsFilePath, header)
-	defer reqsOutputWriter.close()
+	outputReqsFilePath := outputFilePath(outputPathAndFileName+"-reqs", *outputFormat, *gzipped)
+	reqsOutputWriter, err := newOutputWriter(outputReqsFilePath, *outputFormat, *gzipped, *sampleEvery, *sampleNonTrivial)
 	if err != nil {
 		log.Fatalf("Error creating LB's reqsOutputWriter: %q", err)
 	}
+	var listener sim.Listener = reqsOutputWriter
+	var trace *sim.TraceListener
+	if *tracePath != "" {
+		traceFile, err := os.Create(*tracePath)
+		if err != nil {
+			log.Fatalf("Error creating the trace file: %q", err)
+		}
+		defer traceFile.Close()
+		trace = sim.NewTraceListener(traceFile)
+		listener = sim.MultiListener(reqsOutputWriter, trace)
+	}
+	// Interrupting the simulation (e.g. Ctrl+C) stops it and flushes the partial results.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
 	fmt.Println("RUNNING THE SIMULATION")
-	res := sim.Run(*duration, *idlenessDeadline, sim.NewPoissonInterArrival(*lambda), entries, reqsOutputWriter, *scheduler, *warmUp)
+	// The GC-aware scheduler is compared to its baseline on the same arrivals.
+	run := sim.RunContext
+	if *scheduler == 3 {
+		run = sim.RunGCIComparison
+	}
+	res, err := run(ctx, sim.Config{
+		Duration:         *duration,
+		IdlenessDeadline: *idlenessDeadline,
+		InterArrival:     sim.NewPoissonInterArrival(*lambda),
+		Entries:          entries,
+		Listener:         listener,
+		Scheduler:        *scheduler,
+		GCIThreshold:     *gciThreshold,
+		WarmUp:           warmUp,
+		MetricsWarmUp:    *metricsWarmUp,
+		ServiceTime:      serviceTime,
+		Replay:           replayStrategy,
+		BlockSize:        *blockSize,
+		RandomFiles:      *randomFiles,
+		Dispatch:         dispatchStrategy,
+		Functions:        functions,
+		Capacity:         capacity,
+		MemoryMB:         *memoryMB,
+		CPUs:             *cpus,
+		Snapshot:         snapshot,
+		Progress:         printProgress,
+		ProgressInterval: *progress,
+	})
+	stop()
+	if err != nil && !res.Interrupted {
+		log.Fatal(err)
+	}
+	if err != nil {
+		fmt.Printf("SIMULATION INTERRUPTED (%v), SAVING PARTIAL RESULTS\n", err)
+	}
+	if err := reqsOutputWriter.close(); err != nil {
+		log.Fatalf("Error saving the simulated requests: %q", err)
+	}
+	if trace != nil {
+		if err := trace.Close(); err != nil {
+			log.Fatalf("Error saving the simulation trace: %q", err)
+		}
+	}
 
 	err = saveSimulatedData(res, *scenario, schedulerName, outputPathAndFileName)
 	if err != nil {
@@ -79,20 +234,58 @@ func main() {
 	fmt.Println("SIMULATION FINISHED")
 }
 
+func printProgress(p sim.Progress) {
+	fmt.Fprintf(os.Stderr, "progress: %.1f%% simulated time: %.1fs/%.0fs, requests: %d, finished: %d, live instances: %d, events/s: %.0f, elapsed: %v\n",
+		100*p.SimulatedTime/p.Duration.Seconds(), p.SimulatedTime, p.Duration.Seconds(), p.RequestCount,
+		p.FinishedRequests, p.LiveInstances, p.EventsPerSecond, p.Elapsed.Round(time.Second))
+}
+
 func saveSimulatedData(res sim.Results, scenario, schedulerName, outputPathAndFileName string) error {
 	outputMetricsFilePath := outputPathAndFileName + "-metrics.log"
 	err := saveSimulationMetrics(scenario, schedulerName, outputMetricsFilePath, res)
 	if err != nil {
 		return err
 	}
-	outputInstancesFilePath := outputPathAndFileName + "-instances.csv"
-	err = saveSimulationInstances(outputInstancesFilePath, res.Instances)
+	if len(res.Functions) > 0 {
+		if err := saveFunctionMetrics(outputPathAndFileName+"-functions.csv", res); err != nil {
+			return err
+		}
+	}
+	if len(res.Hosts) > 0 {
+		if err := saveHostMetrics(outputPathAndFileName+"-hosts.csv", res.Hosts); err != nil {
+			return err
+		}
+	}
+	outputInstancesFilePath := outputFilePath(outputPathAndFileName+"-instances", *outputFormat, *gzipped)
+	err = saveSimulationInstances(outputInstancesFilePath, *outputFormat, *gzipped, res.Instances)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// readEntries reads the comma-separated input files.
+func readEntries(paths string) ([][]sim.InputEntry, error) {
+	var entries [][]sim.InputEntry
+	for _, p := range strings.Split(paths, ",") {
+		f, err := os.Open(p)
+		if err != nil {
+			return nil, fmt.Errorf("Error opening the file (%s), %q", p, err)
+		}
+		records, err := readRecords(f, p)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Error reading records: %q", err)
+		}
+		e, err := buildEntryArray(records)
+		if err != nil {
+			return nil, fmt.Errorf("Error building entries %s. Error: %q", p, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
 func buildEntryArray(records [][]string) ([]sim.InputEntry, error) {
 	if len(records) == 0 {
 		return nil, fmt.Errorf("Must have at least one file input!")
@@ -1,49 +1,376 @@
 package main
 
 import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
-	"log"
+	"io"
 	"os"
+	"strconv"
 
 	"github.com/gcinterceptor/gci-simulator/serverless/sim"
+	"github.com/parquet-go/parquet-go"
 )
 
-type outputWriter struct {
-	f *os.File
+// Output formats supported by the simulation sinks.
+const (
+	formatCSV     = "csv"
+	formatJSONL   = "jsonl"
+	formatParquet = "parquet"
+)
+
+// record is implemented by every row type the simulator outputs. The CSV
+// sink needs the header and the field values as strings, while the JSON Lines
+// and Parquet sinks rely on the struct tags of the concrete type.
+type record interface {
+	csvHeader() []string
+	csvFields() []string
+}
+
+// recordWriter is a sink for simulation records.
+type recordWriter interface {
+	write(r record) error
+	close() error
+}
+
+func newRecordWriter(format string, w io.Writer, schema record, opts ...parquet.WriterOption) (recordWriter, error) {
+	switch format {
+	case formatCSV:
+		return newCSVRecordWriter(w, schema)
+	case formatJSONL:
+		return &jsonlRecordWriter{enc: json.NewEncoder(w)}, nil
+	case formatParquet:
+		return &parquetRecordWriter{w: parquet.NewWriter(w, append(opts, parquet.SchemaOf(schema))...)}, nil
+	default:
+		return nil, fmt.Errorf("Unknown output format: %s", format)
+	}
+}
+
+func outputExtension(format string) string {
+	return "." + format
+}
+
+type csvRecordWriter struct {
+	w *csv.Writer
+}
+
+func newCSVRecordWriter(w io.Writer, schema record) (*csvRecordWriter, error) {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(schema.csvHeader()); err != nil {
+		return nil, fmt.Errorf("Error trying to write the csv header: %q", err)
+	}
+	return &csvRecordWriter{w: cw}, nil
+}
+
+func (c *csvRecordWriter) write(r record) error {
+	return c.w.Write(r.csvFields())
+}
+
+func (c *csvRecordWriter) close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type jsonlRecordWriter struct {
+	enc *json.Encoder
+}
+
+func (j *jsonlRecordWriter) write(r record) error {
+	return j.enc.Encode(r)
+}
+
+func (j *jsonlRecordWriter) close() error {
+	return nil
+}
+
+type parquetRecordWriter struct {
+	w *parquet.Writer
+}
+
+func (p *parquetRecordWriter) write(r record) error {
+	return p.w.Write(r)
+}
+
+func (p *parquetRecordWriter) close() error {
+	return p.w.Close()
+}
+
+// requestRecord is the output row of a simulated request.
+type requestRecord struct {
+	ID           int64     `json:"id" parquet:"id"`
+	Status       int64     `json:"status" parquet:"status"`
+	CreatedTime  float64   `json:"created_time" parquet:"created_time"`
+	ResponseTime float64   `json:"response_time" parquet:"response_time"`
+	Hops         []string  `json:"hops" parquet:"hops,list"`
+	Responses    []float64 `json:"responses" parquet:"responses,list"`
+	Function     string    `json:"function" parquet:"function"`
+}
+
+func newRequestRecord(r *sim.Request) *requestRecord {
+	hops := r.Hops
+	if hops == nil {
+		hops = []string{}
+	}
+	responses := r.Responses
+	if responses == nil {
+		responses = []float64{}
+	}
+	return &requestRecord{
+		ID:           r.ID,
+		Status:       int64(r.Status),
+		CreatedTime:  r.CreatedTime,
+		ResponseTime: r.ResponseTime,
+		Hops:         hops,
+		Responses:    responses,
+		Function:     r.Function,
+	}
+}
+
+func (r *requestRecord) csvHeader() []string {
+	return []string{"id", "status", "created_time", "response_time", "hops", "responses", "function"}
+}
+
+// csvFields serializes hops and responses as JSON arrays, so they can be read
+// back as lists instead of being re-parsed from Go's %v formatting.
+func (r *requestRecord) csvFields() []string {
+	hops, _ := json.Marshal(r.Hops)
+	responses, _ := json.Marshal(r.Responses)
+	return []string{
+		strconv.FormatInt(r.ID, 10),
+		strconv.FormatInt(r.Status, 10),
+		formatFloat(r.CreatedTime),
+		formatFloat(r.ResponseTime),
+		string(hops),
+		string(responses),
+		r.Function,
+	}
+}
+
+// instanceRecord is the output row of an instance used on the simulation.
+type instanceRecord struct {
+	ID           string  `json:"id" parquet:"id"`
+	IsTerminated bool    `json:"is_terminated" parquet:"is_terminated"`
+	IsWorking    bool    `json:"is_working" parquet:"is_working"`
+	IsAvailable  bool    `json:"is_available" parquet:"is_available"`
+	LastWorked   float64 `json:"lastWorked" parquet:"lastWorked"`
+	BusyTime     float64 `json:"busyTime" parquet:"busyTime"`
+	UpTime       float64 `json:"up_time" parquet:"up_time"`
+	IdleTime     float64 `json:"idle_time" parquet:"idle_time"`
+	Efficiency   float64 `json:"efficiency" parquet:"efficiency"`
+	CreatedTime  float64 `json:"created_time" parquet:"created_time"`
+}
+
+func newInstanceRecord(i sim.IInstance) *instanceRecord {
+	return &instanceRecord{
+		ID:           i.GetId(),
+		IsTerminated: i.IsTerminated(),
+		IsWorking:    i.IsWorking(),
+		IsAvailable:  i.IsAvailable(),
+		LastWorked:   i.GetLastWorked(),
+		BusyTime:     i.GetBusyTime(),
+		UpTime:       i.GetUpTime(),
+		IdleTime:     i.GetIdleTime(),
+		Efficiency:   i.GetEfficiency(),
+		CreatedTime:  i.GetCreatedTime(),
+	}
+}
+
+func (r *instanceRecord) csvHeader() []string {
+	return []string{"id", "is_terminated", "is_working", "is_available", "lastWorked", "busyTime", "up_time", "idle_time", "efficiency", "created_time"}
+}
+
+func (r *instanceRecord) csvFields() []string {
+	return []string{
+		r.ID,
+		strconv.FormatBool(r.IsTerminated),
+		strconv.FormatBool(r.IsWorking),
+		strconv.FormatBool(r.IsAvailable),
+		formatFloat(r.LastWorked),
+		formatFloat(r.BusyTime),
+		formatFloat(r.UpTime),
+		formatFloat(r.IdleTime),
+		formatFloat(r.Efficiency),
+		formatFloat(r.CreatedTime),
+	}
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', 6, 64)
+}
+
+// fileRecordWriter writes records to a buffered and, optionally, gzip
+// compressed file. Parquet has its own compression, so its columns are gzip
+// compressed instead of the whole file.
+type fileRecordWriter struct {
+	recordWriter
+	f  *os.File
+	bw *bufio.Writer
+	gz *gzip.Writer
 }
 
-func newOutputWriter(path, header string) (*outputWriter, error) {
+func newFileRecordWriter(path, format string, gzipped bool, schema record) (*fileRecordWriter, error) {
 	f, err := os.Create(path)
 	if err != nil {
-		return nil, fmt.Errorf("Error trying to create the reqs output file: %q", err)
+		return nil, fmt.Errorf("Error trying to create the output file: %q", err)
+	}
+	fw := &fileRecordWriter{f: f, bw: bufio.NewWriterSize(f, outputBufferSize)}
+	var w io.Writer = fw.bw
+	var opts []parquet.WriterOption
+	if gzipped {
+		if format == formatParquet {
+			opts = append(opts, parquet.Compression(&parquet.Gzip))
+		} else {
+			fw.gz = gzip.NewWriter(fw.bw)
+			w = fw.gz
+		}
 	}
-	_, err = f.WriteString(header)
+	fw.recordWriter, err = newRecordWriter(format, w, schema, opts...)
 	if err != nil {
-		return nil, fmt.Errorf("Error trying to write the csv reqs header: %q", err)
+		f.Close()
+		return nil, err
 	}
-	return &outputWriter{f: f}, nil
+	return fw, nil
 }
 
-func (o *outputWriter) RequestFinished(r *sim.Request) {
-	s := fmt.Sprintf("%d,%d,%f,%f,%v,%v\n", r.ID, r.Status, r.CreatedTime, r.ResponseTime, r.Hops, r.Responses)
-	_, err := o.f.WriteString(s)
+func (fw *fileRecordWriter) close() error {
+	err := fw.recordWriter.close()
+	if fw.gz != nil {
+		err = firstError(err, fw.gz.Close())
+	}
+	err = firstError(err, fw.bw.Flush())
+	return firstError(err, fw.f.Close())
+}
+
+func outputFilePath(pathAndFileName, format string, gzipped bool) string {
+	path := pathAndFileName + outputExtension(format)
+	if gzipped && format != formatParquet {
+		path += ".gz"
+	}
+	return path
+}
+
+func firstError(err, other error) error {
 	if err != nil {
-		// Crash the simulation binary if we can not write output.
-		log.Fatalf("Error trying to write req s (%s) in file (%v+): %q", s, o.f, err)
+		return err
 	}
+	return other
 }
 
-func (o *outputWriter) close() {
-	o.f.Close()
+const (
+	outputBufferSize = 1 << 20
+	outputQueueSize  = 1 << 12
+)
+
+// outputWriter is the simulation listener that saves finished and throttled
+// requests, the latter with status 429 and the hops they were shed by. The
+// requests are sampled and sent to a goroutine that does the I/O, so the
+// simulation does not wait for disk writes. Write errors do not stop the
+// simulation, the first one is reported when the writer is closed.
+type outputWriter struct {
+	path        string
+	w           recordWriter
+	sampleEvery int64
+	nonTrivial  bool
+	seen        int64
+	records     chan record
+	done        chan struct{}
+	err         error
+}
+
+func newOutputWriter(path, format string, gzipped bool, sampleEvery int64, nonTrivial bool) (*outputWriter, error) {
+	if sampleEvery < 1 {
+		return nil, fmt.Errorf("Sampling interval must be at least 1, got %d", sampleEvery)
+	}
+	w, err := newFileRecordWriter(path, format, gzipped, &requestRecord{})
+	if err != nil {
+		return nil, fmt.Errorf("Error trying to create the reqs writer: %q", err)
+	}
+	o := &outputWriter{
+		path:        path,
+		w:           w,
+		sampleEvery: sampleEvery,
+		nonTrivial:  nonTrivial,
+		records:     make(chan record, outputQueueSize),
+		done:        make(chan struct{}),
+	}
+	go o.loop()
+	return o, nil
+}
+
+func (o *outputWriter) loop() {
+	defer close(o.done)
+	for r := range o.records {
+		if o.err != nil {
+			continue // drain the queue, the error is reported on close
+		}
+		if err := o.w.write(r); err != nil {
+			o.err = fmt.Errorf("Error trying to write req (%d) in file (%s): %q", r.(*requestRecord).ID, o.path, err)
+		}
+	}
+}
+
+func (o *outputWriter) RequestFinished(r *sim.Request) {
+	if !o.sampled(r) {
+		return
+	}
+	o.records <- newRequestRecord(r)
+}
+
+func (o *outputWriter) RequestThrottled(r *sim.Request) {
+	o.RequestFinished(r)
+}
+
+// sampled tells whether the request must be written. When only non-trivial
+// requests are kept, the ones served by the first instance they hit are
+// discarded before the every Nth sampling is applied.
+func (o *outputWriter) sampled(r *sim.Request) bool {
+	if o.nonTrivial && len(r.Hops) <= 1 {
+		return false
+	}
+	o.seen++
+	return (o.seen-1)%o.sampleEvery == 0
+}
+
+func (o *outputWriter) close() error {
+	close(o.records)
+	<-o.done
+	return firstError(o.err, o.w.close())
+}
+
+// servedThroughput returns the requests per second which were not throttled.
+// With the warm up discarded from the metrics, it is the throughput after it.
+func servedThroughput(r sim.Results, simulatedTime float64) float64 {
+	measured := simulatedTime - r.WarmUpTime
+	if measured <= 0 {
+		return 0
+	}
+	served := r.RequestCount - r.WarmUpRequests - (r.Throttled - r.WarmUpThrottled)
+	return float64(served) / measured
 }
 
 func saveSimulationMetrics(scenario, schedulerName, path string, res sim.Results) error {
-	throughput := float64(res.RequestCount) / (*duration).Seconds()
+	simulatedTime := (*duration).Seconds()
+	if res.Interrupted {
+		simulatedTime = res.SimulatedTime
+	}
+	throughput := servedThroughput(res, simulatedTime)
 	totalCost := res.Cost
+	// The instances cost is their total up time, so dividing it by the
+	// simulated time gives the mean number of instances kept alive.
+	meanLiveInstances := 0.0
+	if simulatedTime > 0 {
+		meanLiveInstances = totalCost / simulatedTime
+	}
 	totalEfficiency := res.Efficiency
 	simulationTime := res.SimulationTime
-	s := "scenario,scheduler_name,throughput,instances_cost,instances_efficiency,simulation_exec_time\n"
-	s += fmt.Sprintf("%s,%s,%f,%.5f,%.10f,%d\n", scenario, schedulerName, throughput, totalCost, totalEfficiency, simulationTime)
+	// With the GC-aware scheduler, avoided_shed_hops is measured against a
+	// baseline run of scheduler 2 on the same arrivals, whose shed hops are
+	// baseline_shed_hops, and idle_collections are the 503 entries replaced
+	// by collections while idle. Otherwise they are zero.
+	s := "scenario,scheduler_name,throughput,instances_cost,instances_efficiency,simulation_exec_time,shed_hops,avoided_shed_hops,baseline_shed_hops,idle_collections,instances_created,mean_live_instances,restores,snapshot_gb_seconds\n"
+	s += fmt.Sprintf("%s,%s,%f,%.5f,%.10f,%d,%d,%d,%d,%d,%d,%.5f,%d,%.5f\n", scenario, schedulerName, throughput, totalCost, totalEfficiency, simulationTime, res.ShedHops, res.AvoidedShedHops, res.BaselineShedHops, res.IdleCollections, len(res.Instances), meanLiveInstances, res.Restores, res.SnapshotStorage)
 	f, err := os.Create(path)
 	if err != nil {
 		return fmt.Errorf("Error trying to create the output file: %q", err)
@@ -57,29 +384,62 @@ func saveSimulationMetrics(scenario, schedulerName, path string, res sim.Results
 	return nil
 }
 
-func saveSimulationInstances(path string, instances []sim.IInstance) error {
-	f, err := os.Create(path)
-	if err != nil {
-		return fmt.Errorf("Error trying to create the output file: %q", err)
+// saveFunctionMetrics saves the metrics of each function of a multi-function
+// simulation, followed by their aggregate, named "all", which also has the
+// fairness among the functions.
+func saveFunctionMetrics(path string, res sim.Results) error {
+	simulatedTime := (*duration).Seconds()
+	if res.Interrupted {
+		simulatedTime = res.SimulatedTime
 	}
+	s := "function,memory_mb,requests,throttled,throughput,instances_cost,gb_seconds,instances_efficiency,shed_hops,instances_created,mean_live_instances,evictions,restores,snapshot_gb_seconds,fairness\n"
+	row := func(name string, memoryMB int, r sim.Results, gbSeconds float64, fairness string) {
+		throughput, meanLive := servedThroughput(r, simulatedTime), 0.0
+		if simulatedTime > 0 {
+			meanLive = r.Cost / simulatedTime
+		}
+		s += fmt.Sprintf("%s,%d,%d,%d,%f,%.5f,%.5f,%.10f,%d,%d,%.5f,%d,%d,%.5f,%s\n", name, memoryMB, r.RequestCount, r.Throttled,
+			throughput, r.Cost, gbSeconds, r.Efficiency, r.ShedHops, len(r.Instances), meanLive, r.Evictions, r.Restores, r.SnapshotStorage, fairness)
+	}
+	totalGBSeconds := 0.0
+	for _, f := range res.Functions {
+		gbSeconds := f.Cost * float64(f.MemoryMB) / 1024
+		totalGBSeconds += gbSeconds
+		row(f.Name, f.MemoryMB, f.Results, gbSeconds, "")
+	}
+	row("all", 0, res, totalGBSeconds, fmt.Sprintf("%.5f", res.Fairness))
+	if err := os.WriteFile(path, []byte(s), 0644); err != nil {
+		return fmt.Errorf("Error trying to write the function metrics: %q", err)
+	}
+	return nil
+}
 
-	s := fmt.Sprintf("id,is_terminated,is_working,is_available,lastWorked,busyTime,up_time,idle_time,efficiency,created_time\n")
-	_, err = f.WriteString(s)
+// saveHostMetrics saves the placement and utilization of each host of the
+// cluster.
+func saveHostMetrics(path string, hosts []sim.HostResults) error {
+	s := "host,memory_mb,cpus,instances_placed,evictions,peak_memory_mb,memory_utilization,cpu_utilization\n"
+	for _, h := range hosts {
+		s += fmt.Sprintf("%s,%d,%g,%d,%d,%d,%.10f,%.10f\n", h.ID, h.MemoryMB, h.CPUs, h.Instances, h.Evictions, h.PeakMemoryMB, h.MemoryUtilization, h.CPUUtilization)
+	}
+	if err := os.WriteFile(path, []byte(s), 0644); err != nil {
+		return fmt.Errorf("Error trying to write the host metrics: %q", err)
+	}
+	return nil
+}
+
+func saveSimulationInstances(path, format string, gzipped bool, instances []sim.IInstance) error {
+	w, err := newFileRecordWriter(path, format, gzipped, &instanceRecord{})
 	if err != nil {
-		return fmt.Errorf("Error trying to write the csv instances header: %q", err)
+		return fmt.Errorf("Error trying to create the instances writer: %q", err)
 	}
 	for _, i := range instances {
-		s = fmt.Sprintf(
-			"%s,%t,%t,%t,%f,%f,%f,%f,%f,%f\n",
-			i.GetId(), i.IsTerminated(), i.IsWorking(), i.IsAvailable(),
-			i.GetLastWorked(), i.GetBusyTime(), i.GetUpTime(),
-			i.GetIdleTime(), i.GetEfficiency(), i.GetCreatedTime(),
-		)
-		_, err = f.WriteString(s)
-		if err != nil {
-			return fmt.Errorf("Error trying to write the csv instances: %q", err)
+		if err := w.write(newInstanceRecord(i)); err != nil {
+			w.close()
+			return fmt.Errorf("Error trying to write the instances: %q", err)
 		}
 	}
-
+	if err := w.close(); err != nil {
+		return fmt.Errorf("Error trying to flush the instances: %q", err)
+	}
 	return nil
 }
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/gcinterceptor/gci-simulator/serverless/sim"
+	"github.com/parquet-go/parquet-go"
+)
+
+func TestRecordWriter_CSV(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := newRecordWriter(formatCSV, &buf, &requestRecord{})
+	if err != nil {
+		t.Fatalf("Error not expected: %q", err)
+	}
+	req := &sim.Request{ID: 3, Status: 200, CreatedTime: 0.03, ResponseTime: 0.0051, Hops: []string{"i0-f0", "i2-f2"}, Responses: []float64{0.0001, 0.005}, Function: "fn"}
+	if err := w.write(newRequestRecord(req)); err != nil {
+		t.Fatalf("Error not expected: %q", err)
+	}
+	if err := w.close(); err != nil {
+		t.Fatalf("Error not expected: %q", err)
+	}
+	want := "id,status,created_time,response_time,hops,responses,function\n" +
+		`3,200,0.030000,0.005100,"[""i0-f0"",""i2-f2""]","[0.0001,0.005]",fn` + "\n"
+	if want != buf.String() {
+		t.Fatalf("Want: %v, got: %v", want, buf.String())
+	}
+}
+
+func TestRecordWriter_JSONL(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := newRecordWriter(formatJSONL, &buf, &requestRecord{})
+	if err != nil {
+		t.Fatalf("Error not expected: %q", err)
+	}
+	for _, req := range []*sim.Request{
+		{ID: 0, Status: 200, ResponseTime: 0.015, Hops: []string{"i0-f0"}, Responses: []float64{0.015}},
+		{ID: 1},
+	} {
+		if err := w.write(newRequestRecord(req)); err != nil {
+			t.Fatalf("Error not expected: %q", err)
+		}
+	}
+	if err := w.close(); err != nil {
+		t.Fatalf("Error not expected: %q", err)
+	}
+	want := `{"id":0,"status":200,"created_time":0,"response_time":0.015,"hops":["i0-f0"],"responses":[0.015],"function":""}` + "\n" +
+		`{"id":1,"status":0,"created_time":0,"response_time":0,"hops":[],"responses":[],"function":""}` + "\n"
+	if want != buf.String() {
+		t.Fatalf("Want: %v, got: %v", want, buf.String())
+	}
+}
+
+func TestRecordWriter_Parquet(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := newRecordWriter(formatParquet, &buf, &requestRecord{})
+	if err != nil {
+		t.Fatalf("Error not expected: %q", err)
+	}
+	want := []requestRecord{
+		{ID: 0, Status: 200, ResponseTime: 0.015, Hops: []string{"i0-f0"}, Responses: []float64{0.015}},
+		{ID: 1, Status: 200, CreatedTime: 0.01, ResponseTime: 0.0152, Hops: []string{"i2-f2", "i3-f0"}, Responses: []float64{0.0002, 0.015}, Function: "fn"},
+	}
+	for i := range want {
+		if err := w.write(&want[i]); err != nil {
+			t.Fatalf("Error not expected: %q", err)
+		}
+	}
+	if err := w.close(); err != nil {
+		t.Fatalf("Error not expected: %q", err)
+	}
+	got, err := parquet.Read[requestRecord](bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Error not expected: %q", err)
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("Want: %v, got: %v", want, got)
+	}
+}
+
+func TestRecordWriter_UnknownFormat(t *testing.T) {
+	if _, err := newRecordWriter("xml", &bytes.Buffer{}, &requestRecord{}); err == nil {
+		t.Fatal("Error expected")
+	}
+}
+
+type failingRecordWriter struct{ writes int }
+
+func (f *failingRecordWriter) write(r record) error { f.writes++; return errors.New("disk full") }
+func (f *failingRecordWriter) close() error         { return nil }
+
+func TestOutputWriter_Sampling(t *testing.T) {
+	var testData = []struct {
+		desc        string
+		sampleEvery int64
+		nonTrivial  bool
+		want        []int64
+	}{
+		{"All", 1, false, []int64{0, 1, 2, 3, 4, 5}},
+		{"EveryOther", 2, false, []int64{0, 2, 4}},
+		{"NonTrivial", 1, true, []int64{1, 3, 4}},
+		{"EveryOtherNonTrivial", 2, true, []int64{1, 4}},
+	}
+	hops := [][]string{{"i0"}, {"i0", "i1"}, {"i1"}, {"i0", "i1"}, {"i0", "i1", "i2"}, {"i2"}}
+	for _, d := range testData {
+		t.Run(d.desc, func(t *testing.T) {
+			o := &outputWriter{sampleEvery: d.sampleEvery, nonTrivial: d.nonTrivial}
+			got := make([]int64, 0)
+			for id, h := range hops {
+				if o.sampled(&sim.Request{ID: int64(id), Hops: h}) {
+					got = append(got, int64(id))
+				}
+			}
+			if !reflect.DeepEqual(d.want, got) {
+				t.Fatalf("Want: %v, got: %v", d.want, got)
+			}
+		})
+	}
+}
+
+func TestOutputWriter_Gzip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), outputFilePath("reqs", formatJSONL, true))
+	o, err := newOutputWriter(path, formatJSONL, true, 1, false)
+	if err != nil {
+		t.Fatalf("Error not expected: %q", err)
+	}
+	o.RequestFinished(&sim.Request{ID: 7, Status: 200, Hops: []string{"i0-f0"}, Responses: []float64{0.5}, ResponseTime: 0.5})
+	if err := o.close(); err != nil {
+		t.Fatalf("Error not expected: %q", err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Error not expected: %q", err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("Error not expected: %q", err)
+	}
+	got, err := ioutil.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("Error not expected: %q", err)
+	}
+	want := `{"id":7,"status":200,"created_time":0,"response_time":0.5,"hops":["i0-f0"],"responses":[0.5],"function":""}` + "\n"
+	if want != string(got) {
+		t.Fatalf("Want: %v, got: %v", want, string(got))
+	}
+}
+
+func TestOutputWriter_ErrorPropagation(t *testing.T) {
+	fw := &failingRecordWriter{}
+	o := &outputWriter{
+		w:           fw,
+		sampleEvery: 1,
+		records:     make(chan record, outputQueueSize),
+		done:        make(chan struct{}),
+	}
+	go o.loop()
+	for i := int64(0); i < 3; i++ {
+		o.RequestFinished(&sim.Request{ID: i})
+	}
+	if err := o.close(); err == nil {
+		t.Fatal("Error expected")
+	}
+	if fw.writes != 1 {
+		t.Fatalf("Want: %v, got: %v", 1, fw.writes)
+	}
+}
+
+func TestServedThroughput(t *testing.T) {
+	var testData = []struct {
+		desc          string
+		res           sim.Results
+		simulatedTime float64
+		want          float64
+	}{
+		{"AllServed", sim.Results{RequestCount: 100}, 10, 10},
+		{"Throttled", sim.Results{RequestCount: 100, Throttled: 40}, 10, 6},
+		{"WarmUp", sim.Results{RequestCount: 100, Throttled: 40, WarmUpRequests: 20, WarmUpThrottled: 10, WarmUpTime: 5}, 10, 10},
+		{"NoMeasuredTime", sim.Results{RequestCount: 100, WarmUpTime: 10}, 10, 0},
+	}
+	for _, d := range testData {
+		t.Run(d.desc, func(t *testing.T) {
+			if got := servedThroughput(d.res, d.simulatedTime); got != d.want {
+				t.Fatalf("Want: %v, got: %v", d.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package sim
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Host is a node of the cluster the instances are placed on.
+type Host struct {
+	MemoryMB int
+	CPUs     float64 // zero means the CPUs do not limit the instances placed
+}
+
+// PlacementPolicy is the rule picking the host a new instance is placed on,
+// among the ones with enough free memory and CPUs.
+type PlacementPolicy int
+
+const (
+	// PlacementFirstFit picks the first host.
+	PlacementFirstFit PlacementPolicy = iota
+	// PlacementBestFit picks the host left with the least free memory, packing
+	// the instances onto the fewest hosts.
+	PlacementBestFit
+	// PlacementSpread picks the host with the most free memory, spreading the
+	// instances across the hosts.
+	PlacementSpread
+)
+
+var placementPolicyNames = []string{"firstfit", "bestfit", "spread"}
+
+// ParsePlacementPolicy parses the name of a placement policy: firstfit,
+// bestfit or spread.
+func ParsePlacementPolicy(name string) (PlacementPolicy, error) {
+	for i, n := range placementPolicyNames {
+		if n == name {
+			return PlacementPolicy(i), nil
+		}
+	}
+	return 0, fmt.Errorf("Invalid placement policy (%s), must be one of %v", name, placementPolicyNames)
+}
+
+func (p PlacementPolicy) String() string {
+	if p < 0 || int(p) >= len(placementPolicyNames) {
+		return fmt.Sprintf("PlacementPolicy(%d)", int(p))
+	}
+	return placementPolicyNames[p]
+}
+
+// HostResults are the results of one host of the cluster. Utilizations are
+// fractions of the host capacity over the simulated time.
+type HostResults struct {
+	ID                string
+	MemoryMB          int
+	CPUs              float64
+	Instances         int   // instances placed on the host
+	Evictions         int64 // idle instances evicted to make room for new ones
+	PeakMemoryMB      int   // most memory taken by live instances at once
+	MemoryUtilization float64
+	CPUUtilization    float64 // busy time of the instances times their CPUs, zero if the host has no CPUs
+}
+
+// placement is an instance placed on a host.
+type placement struct {
+	instance IInstance
+	lb       *loadBalancer
+	host     *host
+}
+
+type host struct {
+	Host
+	id           string
+	memoryMB     int     // taken by live instances
+	cpus         float64 // taken by live instances
+	peakMemoryMB int
+	placements   []*placement
+	evictions    int64
+}
+
+func (h *host) fits(memoryMB int, cpus float64) bool {
+	if h.memoryMB+memoryMB > h.MemoryMB {
+		return false
+	}
+	return h.CPUs <= 0 || h.cpus+cpus <= h.CPUs
+}
+
+// cluster places the instances of all the functions on its hosts.
+type cluster struct {
+	hosts     []*host
+	policy    PlacementPolicy
+	eviction  bool
+	placed    map[IInstance]*placement // live instances
+	evictions int64
+}
+
+func newCluster(hosts []Host, policy PlacementPolicy, eviction bool) *cluster {
+	c := &cluster{policy: policy, eviction: eviction, placed: make(map[IInstance]*placement)}
+	for n, h := range hosts {
+		c.hosts = append(c.hosts, &host{Host: h, id: "h" + strconv.Itoa(n)})
+	}
+	return c
+}
+
+// pick returns the host a new instance is placed on according to the policy,
+// or nil if no host has room for it.
+func (c *cluster) pick(memoryMB int, cpus float64) *host {
+	var picked *host
+	for _, h := range c.hosts {
+		if !h.fits(memoryMB, cpus) {
+			continue
+		}
+		switch {
+		case picked == nil:
+			picked = h
+		case c.policy == PlacementBestFit && h.MemoryMB-h.memoryMB < picked.MemoryMB-picked.memoryMB:
+			picked = h
+		case c.policy == PlacementSpread && h.MemoryMB-h.memoryMB > picked.MemoryMB-picked.memoryMB:
+			picked = h
+		}
+		if c.policy == PlacementFirstFit {
+			break
+		}
+	}
+	return picked
+}
+
+// evictFor evicts idle instances to make room for a new one on the host which
+// needs the fewest evictions, evicting the least recently used instances
+// first. It returns the host, or nil if no host has room even evicting all its
+// idle instances.
+func (c *cluster) evictFor(memoryMB int, cpus float64) *host {
+	var picked *host
+	var victims []*placement
+	for _, h := range c.hosts {
+		var idle []*placement
+		for _, p := range h.placements {
+			if !p.instance.IsTerminated() && !p.instance.IsWorking() {
+				idle = append(idle, p)
+			}
+		}
+		sort.SliceStable(idle, func(a, b int) bool { return idle[a].instance.GetLastWorked() < idle[b].instance.GetLastWorked() })
+		freedMB, freedCPUs := 0, 0.0
+		for n, p := range idle {
+			freedMB += p.lb.memoryMB
+			freedCPUs += p.lb.cpus
+			if h.fits(memoryMB-freedMB, cpus-freedCPUs) {
+				if picked == nil || n+1 < len(victims) {
+					picked, victims = h, idle[:n+1]
+				}
+				break
+			}
+		}
+	}
+	for _, p := range victims {
+		p.lb.terminateInstance(p.instance)
+		p.lb.evictions++
+		picked.evictions++
+		c.evictions++
+	}
+	return picked
+}
+
+func (c *cluster) place(i IInstance, lb *loadBalancer, h *host) {
+	p := &placement{instance: i, lb: lb, host: h}
+	h.placements = append(h.placements, p)
+	c.placed[i] = p
+}
+
+func (c *cluster) allocate(h *host, memoryMB int, cpus float64) {
+	h.memoryMB += memoryMB
+	h.cpus += cpus
+	if h.memoryMB > h.peakMemoryMB {
+		h.peakMemoryMB = h.memoryMB
+	}
+}
+
+func (c *cluster) release(i IInstance, memoryMB int, cpus float64) {
+	p, ok := c.placed[i]
+	if !ok {
+		return
+	}
+	p.host.memoryMB -= memoryMB
+	p.host.cpus -= cpus
+	delete(c.placed, i)
+}
+
+// results returns the results of the hosts after simulatedTime seconds. The
+// memory and CPUs taken by an instance count during its up time.
+func (c *cluster) results(simulatedTime float64) []HostResults {
+	var res []HostResults
+	for _, h := range c.hosts {
+		r := HostResults{
+			ID:           h.id,
+			MemoryMB:     h.MemoryMB,
+			CPUs:         h.CPUs,
+			Instances:    len(h.placements),
+			Evictions:    h.evictions,
+			PeakMemoryMB: h.peakMemoryMB,
+		}
+		var memoryMBSeconds, cpuSeconds float64
+		for _, p := range h.placements {
+			memoryMBSeconds += float64(p.lb.memoryMB) * p.instance.GetUpTime()
+			cpuSeconds += p.lb.cpus * p.instance.GetBusyTime()
+		}
+		if simulatedTime > 0 {
+			r.MemoryUtilization = memoryMBSeconds / (float64(h.MemoryMB) * simulatedTime)
+			if h.CPUs > 0 {
+				r.CPUUtilization = cpuSeconds / (h.CPUs * simulatedTime)
+			}
+		}
+		res = append(res, r)
+	}
+	return res
+}
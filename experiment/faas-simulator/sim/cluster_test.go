@@ -0,0 +1,116 @@
+package sim
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParsePlacementPolicy(t *testing.T) {
+	for _, p := range []PlacementPolicy{PlacementFirstFit, PlacementBestFit, PlacementSpread} {
+		got, err := ParsePlacementPolicy(p.String())
+		if err != nil {
+			t.Fatalf("Unexpected error: %q", err)
+		}
+		if got != p {
+			t.Fatalf("Want: %v, got: %v", p, got)
+		}
+	}
+	if _, err := ParsePlacementPolicy("foo"); err == nil {
+		t.Fatalf("Want error parsing an unknown policy")
+	}
+}
+
+func TestClusterPick(t *testing.T) {
+	var testData = []struct {
+		desc   string
+		policy PlacementPolicy
+		want   string
+	}{
+		{"FirstFit", PlacementFirstFit, "h0"},
+		{"BestFit", PlacementBestFit, "h2"},
+		{"Spread", PlacementSpread, "h1"},
+	}
+	for _, d := range testData {
+		t.Run(d.desc, func(t *testing.T) {
+			c := newCluster([]Host{{MemoryMB: 1024}, {MemoryMB: 2048}, {MemoryMB: 1024}, {MemoryMB: 1024, CPUs: 1}}, d.policy, false)
+			c.hosts[0].memoryMB = 256
+			c.hosts[2].memoryMB = 512
+			c.hosts[3].cpus = 1 // no CPUs left, although with the least free memory
+			if got := c.pick(256, 0.5); got == nil || got.id != d.want {
+				t.Fatalf("Want: %s, got: %+v", d.want, got)
+			}
+		})
+	}
+	c := newCluster([]Host{{MemoryMB: 1024}}, PlacementFirstFit, false)
+	if got := c.pick(2048, 0); got != nil {
+		t.Fatalf("Want: no host, got: %+v", got)
+	}
+}
+
+// newClusterTestLB returns a load balancer of 512MB instances sharing a
+// cluster of two 1GB hosts.
+func newClusterTestLB(eviction bool) *loadBalancer {
+	capacity := newSharedCapacity(Capacity{Hosts: []Host{{MemoryMB: 1024}, {MemoryMB: 1024}}, Eviction: eviction})
+	lb := &loadBalancer{
+		instances:        make([]IInstance, 0),
+		inputs:           [][]InputEntry{{{200, 0.1, "body", 0, 0.1}}},
+		listener:         voidListener{},
+		idlenessDeadline: time.Minute,
+		memoryMB:         512,
+		capacity:         capacity,
+	}
+	capacity.lbs = []*loadBalancer{lb}
+	return lb
+}
+
+func TestClusterPlacement(t *testing.T) {
+	lb := newClusterTestLB(false)
+	for n := 0; n < 4; n++ {
+		if lb.newInstance(&Request{}) == nil {
+			t.Fatalf("Want: instance %d placed", n)
+		}
+	}
+	if lb.newInstance(&Request{}) != nil {
+		t.Fatalf("Want: no room for a fifth instance")
+	}
+	lb.terminateInstance(lb.created[0])
+	if lb.capacity.cluster.hosts[0].memoryMB != 512 {
+		t.Fatalf("Want: 512MB taken from h0 after the termination, got: %d", lb.capacity.cluster.hosts[0].memoryMB)
+	}
+	if lb.newInstance(&Request{}) == nil {
+		t.Fatalf("Want: instance placed after the termination")
+	}
+}
+
+func TestClusterEviction(t *testing.T) {
+	lb := newClusterTestLB(true)
+	for n := 0; n < 4; n++ {
+		lb.newInstance(&Request{})
+	}
+	// i1 is the least recently used, so it is evicted from h0.
+	for n, lastWorked := range []float64{3, 1, 4, 2} {
+		lb.created[n].(*instance).lastWorked = lastWorked
+	}
+	if lb.newInstance(&Request{}) == nil {
+		t.Fatalf("Want: instance placed evicting an idle one")
+	}
+	if !lb.created[1].IsTerminated() || lb.evictions != 1 {
+		t.Fatalf("Want: i1 evicted, got %d evictions", lb.evictions)
+	}
+	h := lb.capacity.cluster.hosts[0]
+	if h.evictions != 1 || len(h.placements) != 3 || h.memoryMB != 1024 {
+		t.Fatalf("Want: the new instance placed on h0, got: %+v", h)
+	}
+}
+
+func TestClusterResults(t *testing.T) {
+	c := newCluster([]Host{{MemoryMB: 1024, CPUs: 2}}, PlacementFirstFit, false)
+	lb := &loadBalancer{memoryMB: 512, cpus: 1}
+	h := c.pick(512, 1)
+	c.allocate(h, 512, 1)
+	c.place(&instance{createdTime: 0, terminateTime: 10, busyTime: 5}, lb, h)
+	got := c.results(10)[0]
+	if got.Instances != 1 || got.PeakMemoryMB != 512 || got.MemoryUtilization != 0.5 || got.CPUUtilization != 0.25 {
+		t.Fatalf("Unexpected host results: %+v", got)
+	}
+}
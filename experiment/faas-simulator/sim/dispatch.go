@@ -0,0 +1,128 @@
+package sim
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/agoussia/godes"
+)
+
+// DispatchStrategy is the rule the load balancer uses to pick the idle
+// instance that receives a request. A new instance is created only when no
+// instance is idle.
+type DispatchStrategy int
+
+const (
+	// DispatchMRU picks the most recently used instance, so the least
+	// recently used ones reach the idleness deadline.
+	DispatchMRU DispatchStrategy = iota
+	// DispatchLRU picks the least recently used instance.
+	DispatchLRU
+	// DispatchRandom picks an instance uniformly.
+	DispatchRandom
+	// DispatchRoundRobin cycles through the instances in their creation order.
+	DispatchRoundRobin
+	// DispatchPowerOfTwo draws two instances and picks the most recently used
+	// of them.
+	DispatchPowerOfTwo
+	// DispatchPack bin-packs the requests first-fit: the instances are bins
+	// taken in their creation order, and a request fits in the first one with
+	// idle time left until its idleness deadline. The requests are packed onto
+	// the oldest instances, so the remaining idle time of the newer ones runs
+	// out and they are terminated.
+	DispatchPack
+)
+
+var dispatchStrategyNames = []string{"mru", "lru", "random", "roundrobin", "p2c", "pack"}
+
+// ParseDispatchStrategy parses the name of a dispatch strategy: mru, lru,
+// random, roundrobin, p2c or pack.
+func ParseDispatchStrategy(name string) (DispatchStrategy, error) {
+	for i, n := range dispatchStrategyNames {
+		if n == name {
+			return DispatchStrategy(i), nil
+		}
+	}
+	return 0, fmt.Errorf("Invalid dispatch strategy (%s), must be one of %v", name, dispatchStrategyNames)
+}
+
+func (s DispatchStrategy) String() string {
+	if s < 0 || int(s) >= len(dispatchStrategyNames) {
+		return fmt.Sprintf("DispatchStrategy(%d)", int(s))
+	}
+	return dispatchStrategyNames[s]
+}
+
+// canReceive returns whether the instance may receive the request.
+func canReceive(i IInstance, r *Request) bool {
+	return !i.IsWorking() && !i.IsTerminated() && !r.hasBeenProcessed(i.GetId())
+}
+
+// candidates returns the instances which may receive the request, in the order
+// of preference of the dispatch strategy.
+func (lb *loadBalancer) candidates(r *Request) []IInstance {
+	var c []IInstance
+	switch lb.dispatchStrategy {
+	case DispatchRoundRobin:
+		for n := range lb.created {
+			if i := lb.created[(lb.roundRobinNext+n)%len(lb.created)]; canReceive(i, r) {
+				c = append(c, i)
+			}
+		}
+		return c
+	case DispatchPack:
+		now := godes.GetSystemTime()
+		for _, i := range lb.created {
+			if canReceive(i, r) {
+				c = append(c, i)
+			}
+		}
+		// Instances without idle time left, about to be terminated, are the
+		// last resort.
+		sort.SliceStable(c, func(a, b int) bool {
+			return lb.remainingIdleTime(c[a], now) > 0 && lb.remainingIdleTime(c[b], now) <= 0
+		})
+		return c
+	}
+	for _, i := range lb.instances {
+		if canReceive(i, r) {
+			c = append(c, i)
+		}
+	}
+	switch lb.dispatchStrategy {
+	case DispatchLRU:
+		// lb.instances are sorted from the most recently used.
+		for a, b := 0, len(c)-1; a < b; a, b = a+1, b-1 {
+			c[a], c[b] = c[b], c[a]
+		}
+	case DispatchRandom:
+		lb.random().Shuffle(len(c), func(a, b int) { c[a], c[b] = c[b], c[a] })
+	case DispatchPowerOfTwo:
+		if len(c) > 2 {
+			lb.random().Shuffle(len(c), func(a, b int) { c[a], c[b] = c[b], c[a] })
+			c = c[:2]
+			sort.SliceStable(c, func(a, b int) bool { return c[a].GetLastWorked() > c[b].GetLastWorked() })
+		}
+	}
+	return c
+}
+
+// remainingIdleTime returns the seconds the instance may still be idle until
+// its idleness deadline.
+func (lb *loadBalancer) remainingIdleTime(i IInstance, now float64) float64 {
+	return lb.idlenessDeadline.Seconds() - (now - i.GetLastWorked())
+}
+
+// dispatched updates the state of the dispatch strategy after the instance was
+// picked.
+func (lb *loadBalancer) dispatched(picked IInstance) {
+	if lb.dispatchStrategy != DispatchRoundRobin {
+		return
+	}
+	for n, i := range lb.created {
+		if i == picked {
+			lb.roundRobinNext = (n + 1) % len(lb.created)
+			return
+		}
+	}
+}
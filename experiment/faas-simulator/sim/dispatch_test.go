@@ -0,0 +1,131 @@
+package sim
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/agoussia/godes"
+	"golang.org/x/exp/rand"
+)
+
+func TestParseDispatchStrategy(t *testing.T) {
+	for _, s := range []DispatchStrategy{DispatchMRU, DispatchLRU, DispatchRandom, DispatchRoundRobin, DispatchPowerOfTwo, DispatchPack} {
+		got, err := ParseDispatchStrategy(s.String())
+		if err != nil {
+			t.Fatalf("Unexpected error: %q", err)
+		}
+		if got != s {
+			t.Fatalf("Want: %v, got: %v", s, got)
+		}
+	}
+	if _, err := ParseDispatchStrategy("foo"); err == nil {
+		t.Fatalf("Want error parsing an unknown strategy")
+	}
+}
+
+// newDispatchTestLB returns a load balancer with three idle instances, i0-f0
+// created first and used last.
+func newDispatchTestLB(s DispatchStrategy) *loadBalancer {
+	lb := &loadBalancer{
+		instances:        make([]IInstance, 0),
+		inputs:           [][]InputEntry{{{200, 0.1, "body", 0, 0.1}}},
+		dispatchStrategy: s,
+		rnd:              rand.New(rand.NewSource(1)),
+	}
+	for n := 0; n < 3; n++ {
+		lb.newInstance(&Request{Status: 200})
+	}
+	for n, i := range lb.created {
+		i.(*instance).lastWorked = float64(len(lb.created) - n)
+	}
+	// as nextInstance does, the instances are sorted from the most recently used.
+	lb.instances = []IInstance{lb.created[0], lb.created[1], lb.created[2]}
+	return lb
+}
+
+func ids(instances []IInstance) []string {
+	var s []string
+	for _, i := range instances {
+		s = append(s, i.GetId())
+	}
+	return s
+}
+
+func TestCandidates(t *testing.T) {
+	var testData = []struct {
+		desc       string
+		strategy   DispatchStrategy
+		lastWorked []float64 // of the instances in creation order, from now, if not the default
+		want       []string
+	}{
+		{"MRU", DispatchMRU, nil, []string{"i0-f0", "i1-f0", "i2-f0"}},
+		{"LRU", DispatchLRU, nil, []string{"i2-f0", "i1-f0", "i0-f0"}},
+		{"Pack", DispatchPack, nil, []string{"i0-f0", "i1-f0", "i2-f0"}},
+		// MRU picks i1-f0, pack the oldest instance with idle time left.
+		{"MRUNotByCreation", DispatchMRU, []float64{1, 3, 2}, []string{"i1-f0", "i2-f0", "i0-f0"}},
+		{"PackNotByLastWork", DispatchPack, []float64{1, 3, 2}, []string{"i0-f0", "i1-f0", "i2-f0"}},
+		{"PackNoIdleTimeLeft", DispatchPack, []float64{-1, 3, 2}, []string{"i1-f0", "i2-f0", "i0-f0"}},
+	}
+	for _, d := range testData {
+		t.Run(d.desc, func(t *testing.T) {
+			lb := newDispatchTestLB(d.strategy)
+			for n, lastWorked := range d.lastWorked {
+				lb.created[n].(*instance).lastWorked = godes.GetSystemTime() + lastWorked
+			}
+			sort.SliceStable(lb.instances, func(a, b int) bool {
+				return lb.instances[a].GetLastWorked() > lb.instances[b].GetLastWorked()
+			})
+			if got := ids(lb.candidates(&Request{})); !reflect.DeepEqual(got, d.want) {
+				t.Fatalf("Want: %v, got: %v", d.want, got)
+			}
+		})
+	}
+}
+
+func TestCandidates_SkipsProcessed(t *testing.T) {
+	lb := newDispatchTestLB(DispatchLRU)
+	want := []string{"i1-f0", "i0-f0"}
+	if got := ids(lb.candidates(&Request{Hops: []string{"i2-f0"}})); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Want: %v, got: %v", want, got)
+	}
+}
+
+func TestCandidates_RoundRobin(t *testing.T) {
+	lb := newDispatchTestLB(DispatchRoundRobin)
+	var got []string
+	for n := 0; n < 4; n++ {
+		picked := lb.candidates(&Request{})[0]
+		lb.dispatched(picked)
+		got = append(got, picked.GetId())
+	}
+	want := []string{"i0-f0", "i1-f0", "i2-f0", "i0-f0"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Want: %v, got: %v", want, got)
+	}
+}
+
+func TestCandidates_PowerOfTwo(t *testing.T) {
+	lb := newDispatchTestLB(DispatchPowerOfTwo)
+	for n := 0; n < 10; n++ {
+		c := lb.candidates(&Request{})
+		if len(c) != 2 || c[0].GetLastWorked() < c[1].GetLastWorked() {
+			t.Fatalf("Want: two instances, the most recently used first, got: %v", ids(c))
+		}
+	}
+}
+
+func TestCandidates_Random(t *testing.T) {
+	lb := newDispatchTestLB(DispatchRandom)
+	seen := make(map[string]bool)
+	for n := 0; n < 50; n++ {
+		c := lb.candidates(&Request{})
+		if len(c) != 3 {
+			t.Fatalf("Want: 3 candidates, got: %v", ids(c))
+		}
+		seen[c[0].GetId()] = true
+	}
+	if len(seen) != 3 {
+		t.Fatalf("Want: every instance picked first at some point, got: %v", seen)
+	}
+}
@@ -0,0 +1,198 @@
+package sim
+
+import (
+	"fmt"
+	"time"
+)
+
+// Function is one of the functions of a simulation, with its own arrival
+// process, inputs, memory size and keep-alive policy.
+type Function struct {
+	Name             string         // prefixes the ids of the function instances
+	InterArrival     InterArrival   // time between two requests arrivals
+	Entries          [][]InputEntry // inputs replayed by the instances, one per file
+	MemoryMB         int            // memory each instance takes from Capacity.MemoryMB and its host
+	CPUs             float64        // CPUs each instance takes from its host
+	IdlenessDeadline time.Duration  // time an instance may be idle until be terminated
+
+	// ServiceTime, when not nil, is sampled by the instances instead of
+	// replaying the entries.
+	ServiceTime *ServiceTimeModel
+
+	// Snapshot, when not nil, replaces the cold start of the instances which
+	// are not warmed by the scheduler.
+	Snapshot *SnapshotModel
+}
+
+// Capacity is shared by the functions of a simulation. When a function needs
+// a new instance and there is no capacity left, the request is throttled.
+// Zero fields mean no limit.
+type Capacity struct {
+	ConcurrencyLimit int // live instances of all the functions, as an account-level concurrency limit
+	MemoryMB         int // memory of the host pool the live instances take
+
+	// Hosts, when not empty, is the cluster the instances are placed on,
+	// according to the Placement policy. With Eviction, idle instances are
+	// evicted to make room for new ones when no host has it.
+	Hosts     []Host
+	Placement PlacementPolicy
+	Eviction  bool
+}
+
+// FunctionResults are the results of one function of a simulation.
+type FunctionResults struct {
+	Name     string
+	MemoryMB int
+	Results
+}
+
+// StatusThrottled is the status of the requests throttled because there was no
+// capacity left for a new instance.
+const StatusThrottled = 429
+
+// sharedCapacity tracks the capacity the live instances of all the functions
+// take.
+type sharedCapacity struct {
+	limit     Capacity
+	instances int
+	memoryMB  int
+	lbs       []*loadBalancer
+	cluster   *cluster // nil without hosts
+}
+
+func newSharedCapacity(limit Capacity) *sharedCapacity {
+	c := &sharedCapacity{limit: limit}
+	if len(limit.Hosts) > 0 {
+		c.cluster = newCluster(limit.Hosts, limit.Placement, limit.Eviction)
+	}
+	return c
+}
+
+func (c *sharedCapacity) fits(memoryMB int) bool {
+	if c.limit.ConcurrencyLimit > 0 && c.instances+1 > c.limit.ConcurrencyLimit {
+		return false
+	}
+	return c.limit.MemoryMB <= 0 || c.memoryMB+memoryMB <= c.limit.MemoryMB
+}
+
+// reserve returns the host a new instance of the load balancer is placed on,
+// which is nil without hosts, and whether there is capacity for it.
+func (c *sharedCapacity) reserve(lb *loadBalancer) (*host, bool) {
+	if !c.fits(lb.memoryMB) {
+		return nil, false
+	}
+	if c.cluster == nil {
+		return nil, true
+	}
+	h := c.cluster.pick(lb.memoryMB, lb.cpus)
+	return h, h != nil
+}
+
+// acquire takes the capacity of a new instance of the load balancer,
+// returning its host, which is nil without hosts, and false if there is no
+// capacity left.
+func (c *sharedCapacity) acquire(lb *loadBalancer) (*host, bool) {
+	h, ok := c.reserve(lb)
+	if !ok {
+		// Instances past their idleness deadline are only terminated when
+		// their load balancer gets a request, so their capacity is reclaimed
+		// before throttling.
+		for _, other := range c.lbs {
+			other.tryScaleDown()
+		}
+		h, ok = c.reserve(lb)
+	}
+	if !ok && c.cluster != nil && c.cluster.eviction && c.fits(lb.memoryMB) {
+		h = c.cluster.evictFor(lb.memoryMB, lb.cpus)
+		ok = h != nil
+	}
+	if !ok {
+		return nil, false
+	}
+	c.instances++
+	c.memoryMB += lb.memoryMB
+	if h != nil {
+		c.cluster.allocate(h, lb.memoryMB, lb.cpus)
+	}
+	return h, true
+}
+
+// place records the host of a new instance of the load balancer.
+func (c *sharedCapacity) place(i IInstance, lb *loadBalancer, h *host) {
+	if h != nil {
+		c.cluster.place(i, lb, h)
+	}
+}
+
+func (c *sharedCapacity) release(i IInstance, lb *loadBalancer) {
+	c.instances--
+	c.memoryMB -= lb.memoryMB
+	if c.cluster != nil {
+		c.cluster.release(i, lb.memoryMB, lb.cpus)
+	}
+}
+
+// validateFunctions checks the functions can share the capacity and their
+// instances ids do not collide.
+func validateFunctions(functions []Function, capacity Capacity) error {
+	names := make(map[string]bool)
+	for _, f := range functions {
+		if len(functions) > 1 && f.Name == "" {
+			return fmt.Errorf("Invalid function, every function of a multi-function simulation needs a name")
+		}
+		if names[f.Name] {
+			return fmt.Errorf("Invalid function (%s), the name is repeated", f.Name)
+		}
+		names[f.Name] = true
+		if f.InterArrival == nil || len(f.Entries) == 0 {
+			return fmt.Errorf("Invalid function (%s), it needs an inter-arrival and inputs", f.Name)
+		}
+		if capacity.MemoryMB > 0 && f.MemoryMB <= 0 {
+			return fmt.Errorf("Invalid function (%s), the host pool memory requires the memory size of every function", f.Name)
+		}
+		if capacity.MemoryMB > 0 && f.MemoryMB > capacity.MemoryMB {
+			return fmt.Errorf("Invalid function (%s), its memory size (%dMB) is larger than the host pool (%dMB)", f.Name, f.MemoryMB, capacity.MemoryMB)
+		}
+		if len(capacity.Hosts) > 0 {
+			if f.MemoryMB <= 0 {
+				return fmt.Errorf("Invalid function (%s), the hosts require the memory size of every function", f.Name)
+			}
+			if newCluster(capacity.Hosts, PlacementFirstFit, false).pick(f.MemoryMB, f.CPUs) == nil {
+				return fmt.Errorf("Invalid function (%s), its instances (%dMB, %v CPUs) do not fit any host", f.Name, f.MemoryMB, f.CPUs)
+			}
+		}
+	}
+	return nil
+}
+
+// earliestArrival returns the function whose next request arrives first.
+func earliestArrival(next []float64) int {
+	n := 0
+	for m, t := range next {
+		if t < next[n] {
+			n = m
+		}
+	}
+	return n
+}
+
+// fairness returns the Jain's index of the fraction of the requests of each
+// function which were not throttled: 1 when every function gets the same
+// share of its requests served and 1/n when one function gets it all.
+func fairness(functions []FunctionResults) float64 {
+	var sum, squares float64
+	n := 0
+	for _, f := range functions {
+		if f.RequestCount == 0 {
+			continue
+		}
+		x := float64(f.RequestCount-f.Throttled) / float64(f.RequestCount)
+		sum += x
+		squares += x * x
+		n++
+	}
+	if squares == 0 {
+		return 1
+	}
+	return sum * sum / (float64(n) * squares)
+}
@@ -0,0 +1,210 @@
+package sim
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/agoussia/godes"
+)
+
+func TestSharedCapacity(t *testing.T) {
+	var testData = []struct {
+		desc     string
+		limit    Capacity
+		memoryMB int
+		want     int // instances acquired
+	}{
+		{"NoLimit", Capacity{}, 512, 5},
+		{"ConcurrencyLimit", Capacity{ConcurrencyLimit: 3}, 512, 3},
+		{"MemoryPool", Capacity{MemoryMB: 1024}, 512, 2},
+		{"Both", Capacity{ConcurrencyLimit: 3, MemoryMB: 1024}, 256, 3},
+	}
+	for _, d := range testData {
+		t.Run(d.desc, func(t *testing.T) {
+			c := newSharedCapacity(d.limit)
+			lb := &loadBalancer{memoryMB: d.memoryMB}
+			got := 0
+			for n := 0; n < 5; n++ {
+				if _, ok := c.acquire(lb); ok {
+					got++
+				}
+			}
+			if got != d.want {
+				t.Fatalf("Want: %d, got: %d", d.want, got)
+			}
+			c.release(nil, lb)
+			if _, ok := c.acquire(lb); !ok {
+				t.Fatalf("Want: capacity acquired after a release")
+			}
+		})
+	}
+}
+
+type throttleTestListener struct {
+	finished  []*Request
+	throttled []*Request
+}
+
+func (l *throttleTestListener) RequestFinished(r *Request)  { l.finished = append(l.finished, r) }
+func (l *throttleTestListener) RequestThrottled(r *Request) { l.throttled = append(l.throttled, r) }
+
+func TestDispatch_Throttled(t *testing.T) {
+	l := &throttleTestListener{}
+	capacity := &sharedCapacity{limit: Capacity{MemoryMB: 512}}
+	lb := &loadBalancer{
+		instances:        make([]IInstance, 0),
+		inputs:           [][]InputEntry{{{200, 0.1, "body", 0, 0.1}}},
+		listener:         l,
+		idlenessDeadline: time.Minute,
+		name:             "fn",
+		memoryMB:         512,
+		capacity:         capacity,
+		metricsWarmUp:    NewWarmUpFilter(WarmUp{Entries: 2}, l),
+	}
+	capacity.lbs = []*loadBalancer{lb}
+	if i := lb.nextInstance(&Request{}); i == nil || i.GetId() != "fn-i0-f0" {
+		t.Fatalf("Want: instance fn-i0-f0, got: %v", i)
+	}
+	// The request was shed by the only instance and the pool has no memory
+	// left for another one.
+	r := &Request{ID: 1, Status: 503, Hops: []string{"fn-i0-f0"}}
+	lb.dispatch(r)
+	if r.Status != StatusThrottled || lb.throttledReqs != 1 || len(l.throttled) != 1 {
+		t.Fatalf("Want: request throttled, got status %d, %d throttled and %d notified", r.Status, lb.throttledReqs, len(l.throttled))
+	}
+	if len(l.finished) != 0 {
+		t.Fatalf("Want: the throttled request not finished, got %d finished", len(l.finished))
+	}
+	if lb.warmUpThrottled != 1 {
+		t.Fatalf("Want: request throttled during the warm up, got: %d", lb.warmUpThrottled)
+	}
+}
+
+func TestSharedCapacity_ReclaimsIdleInstances(t *testing.T) {
+	capacity := &sharedCapacity{limit: Capacity{ConcurrencyLimit: 1}}
+	other := &loadBalancer{
+		instances:        make([]IInstance, 0),
+		inputs:           [][]InputEntry{{{200, 0.1, "body", 0, 0.1}}},
+		idlenessDeadline: 0,
+		listener:         voidListener{},
+		name:             "other",
+		capacity:         capacity,
+	}
+	capacity.lbs = []*loadBalancer{other}
+	if other.newInstance(&Request{}) == nil {
+		t.Fatalf("Want: an instance of the other function")
+	}
+	// The idle instance of the other function is past its idleness deadline,
+	// so its capacity is reclaimed.
+	if _, ok := capacity.acquire(&loadBalancer{}); !ok {
+		t.Fatalf("Want: capacity reclaimed from the idle instance")
+	}
+	if !other.instances[0].IsTerminated() {
+		t.Fatalf("Want: the idle instance terminated")
+	}
+}
+
+func TestValidateFunctions(t *testing.T) {
+	valid := Function{Name: "a", InterArrival: NewConstantInterArrival(1), Entries: [][]InputEntry{{{200, 0.1, "body", 0, 0.1}}}, MemoryMB: 256}
+	unnamed, noMemory, huge, noInputs := valid, valid, valid, valid
+	unnamed.Name = ""
+	noMemory.MemoryMB = 0
+	huge.MemoryMB = 4096
+	noInputs.Entries = nil
+	var testData = []struct {
+		desc      string
+		functions []Function
+		capacity  Capacity
+		wantErr   bool
+	}{
+		{"Single", []Function{unnamed}, Capacity{}, false},
+		{"Unnamed", []Function{valid, unnamed}, Capacity{}, true},
+		{"Repeated", []Function{valid, valid}, Capacity{}, true},
+		{"NoInputs", []Function{noInputs}, Capacity{}, true},
+		{"NoMemory", []Function{noMemory}, Capacity{MemoryMB: 1024}, true},
+		{"LargerThanPool", []Function{huge}, Capacity{MemoryMB: 1024}, true},
+		{"NoMemoryWithoutPool", []Function{noMemory}, Capacity{ConcurrencyLimit: 2}, false},
+		{"NoMemoryWithHosts", []Function{noMemory}, Capacity{Hosts: []Host{{MemoryMB: 1024}}}, true},
+		{"LargerThanHosts", []Function{huge}, Capacity{Hosts: []Host{{MemoryMB: 1024}, {MemoryMB: 2048}}}, true},
+		{"FitsAHost", []Function{valid}, Capacity{Hosts: []Host{{MemoryMB: 128}, {MemoryMB: 1024}}}, false},
+	}
+	for _, d := range testData {
+		t.Run(d.desc, func(t *testing.T) {
+			if err := validateFunctions(d.functions, d.capacity); (err != nil) != d.wantErr {
+				t.Fatalf("Want error: %v, got: %v", d.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestEarliestArrival(t *testing.T) {
+	if got := earliestArrival([]float64{0.3, 0.1, 0.2, 0.1}); got != 1 {
+		t.Fatalf("Want: 1, got: %d", got)
+	}
+}
+
+func TestFairness(t *testing.T) {
+	fn := func(requests, throttled int64) FunctionResults {
+		return FunctionResults{Results: Results{RequestCount: requests, Throttled: throttled}}
+	}
+	var testData = []struct {
+		desc      string
+		functions []FunctionResults
+		want      float64
+	}{
+		{"Equal", []FunctionResults{fn(10, 5), fn(100, 50)}, 1},
+		{"OneStarved", []FunctionResults{fn(10, 0), fn(10, 10)}, 0.5},
+		{"NoRequests", []FunctionResults{fn(10, 0), fn(0, 0)}, 1},
+	}
+	for _, d := range testData {
+		t.Run(d.desc, func(t *testing.T) {
+			if got := fairness(d.functions); math.Abs(got-d.want) > 1e-9 {
+				t.Fatalf("Want: %v, got: %v", d.want, got)
+			}
+		})
+	}
+}
+
+func TestRunContext_StarvedFunction(t *testing.T) {
+	// Starts from a new model, as other tests leave theirs running.
+	godes.Verbose(false)
+	godes.Clear()
+	defer godes.Clear()
+	entries := [][]InputEntry{{{200, 0.005, "body", 0, 0.005}}}
+	l := &throttleTestListener{}
+	// The instance of a is kept alive, so b never gets one.
+	res, err := RunContext(context.Background(), Config{
+		Duration: time.Second,
+		Listener: l,
+		Functions: []Function{
+			{Name: "a", InterArrival: NewConstantInterArrival(0.01), Entries: entries, IdlenessDeadline: time.Minute},
+			{Name: "b", InterArrival: NewConstantInterArrival(0.013), Entries: entries, IdlenessDeadline: time.Minute},
+		},
+		Capacity: Capacity{ConcurrencyLimit: 1},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	b := res.Functions[1]
+	if len(b.Instances) != 0 || b.Throttled != b.RequestCount || b.RequestCount == 0 {
+		t.Fatalf("Want: every request of b throttled, got %d of %d and %d instances", b.Throttled, b.RequestCount, len(b.Instances))
+	}
+	if int64(len(l.finished)) != res.Functions[0].RequestCount || int64(len(l.throttled)) != b.RequestCount {
+		t.Fatalf("Want: %d finished and %d throttled, got: %d and %d", res.Functions[0].RequestCount, b.RequestCount, len(l.finished), len(l.throttled))
+	}
+	for _, r := range l.finished {
+		if r.Function != "a" || r.Status != 200 {
+			t.Fatalf("Want: only requests of a finished, got: %+v", r)
+		}
+	}
+	for _, r := range l.throttled {
+		if r.Function != "b" || r.Status != StatusThrottled {
+			t.Fatalf("Want: only requests of b throttled, got: %+v", r)
+		}
+	}
+	if want := res.Functions[0].Efficiency; math.IsNaN(res.Efficiency) || res.Efficiency != want {
+		t.Fatalf("Want: the efficiency of a (%v), got: %v", want, res.Efficiency)
+	}
+}
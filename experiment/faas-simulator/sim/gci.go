@@ -0,0 +1,195 @@
+package sim
+
+import (
+	"context"
+	"math"
+
+	"github.com/agoussia/godes"
+)
+
+// DefaultGCIThreshold is the heap occupancy from which the GC-aware scheduler
+// avoids an instance when Config.GCIThreshold is zero.
+const DefaultGCIThreshold = 0.9
+
+// heapModel estimates the heap occupancy of an instance as the requests it
+// served since its last collection relative to the requests it serves between
+// two collections (its GC cycle). The cycle starts as the mean of the cycles
+// of the instance input and is updated with every collection the load balancer
+// observes, which is a 503 response.
+type heapModel struct {
+	cycle  float64 // mean requests served between two collections
+	cycles int     // collections the cycle is the mean of
+	served int     // requests served since the last collection
+}
+
+// newHeapModel returns the heap model of an instance replaying the input.
+// Entries after the cold start are cycles of 200 entries ended by 503 ones,
+// and the 200 entries after the last 503 are an incomplete cycle. Without
+// 503 entries the cycle is infinite, so the instance is never avoided until a
+// collection is observed.
+func newHeapModel(input []InputEntry) *heapModel {
+	h := &heapModel{cycle: math.Inf(1)}
+	served, total := 0, 0
+	for j := 1; j < len(input); j++ {
+		switch input[j].Status {
+		case 200:
+			served++
+		case 503:
+			if served > 0 {
+				total += served
+				h.cycles++
+				served = 0
+			}
+		}
+	}
+	if h.cycles > 0 {
+		h.cycle = float64(total) / float64(h.cycles)
+	}
+	return h
+}
+
+// requestServed updates the model after the instance answered a request.
+func (h *heapModel) requestServed() {
+	h.served++
+}
+
+// reset updates the model after the instance collected its heap while idle,
+// which tells nothing about the length of its cycle.
+func (h *heapModel) reset() {
+	h.served = 0
+}
+
+// collected updates the model after the instance shed a request. Requests
+// shed during the same collection do not start another cycle.
+func (h *heapModel) collected() {
+	if h.served == 0 {
+		return
+	}
+	if h.cycles == 0 {
+		h.cycle = 0
+	}
+	h.cycle = (h.cycle*float64(h.cycles) + float64(h.served)) / float64(h.cycles+1)
+	h.cycles++
+	h.served = 0
+}
+
+// occupancy returns the fraction of the GC cycle the instance went through,
+// which reaches 1 when a collection is expected.
+func (h *heapModel) occupancy() float64 {
+	return float64(h.served) / h.cycle
+}
+
+// gciThreshold returns the heap occupancy from which instances are avoided.
+func (lb *loadBalancer) gciThreshold() float64 {
+	if lb.heapThreshold <= 0 {
+		return DefaultGCIThreshold
+	}
+	return lb.heapThreshold
+}
+
+// predictedUnavailable returns whether the instance is expected to shed the
+// next request: it is still collecting or its heap occupancy reached the
+// threshold, so its next collection is imminent.
+func (lb *loadBalancer) predictedUnavailable(i IInstance) bool {
+	if !i.IsAvailable() {
+		return true
+	}
+	h, ok := lb.heaps[i.GetId()]
+	return ok && h.occupancy() >= lb.gciThreshold()
+}
+
+// gciSelect picks the first candidate not predicted to be unavailable. The
+// candidates skipped because their collection is imminent collect their heap
+// while out of the dispatch, as GCI does, so their next collection does not
+// shed a request. If every candidate is predicted to be unavailable, it picks
+// the one with the lowest heap occupancy, as a shed request costs less than a
+// cold start.
+func (lb *loadBalancer) gciSelect(candidates []IInstance) IInstance {
+	var lowest IInstance
+	lowestOccupancy := math.Inf(1)
+	for n, i := range candidates {
+		if !lb.predictedUnavailable(i) {
+			for _, skipped := range candidates[:n] {
+				if h, ok := lb.heaps[skipped.GetId()]; ok && skipped.IsAvailable() {
+					skipped.collect()
+					h.reset()
+				}
+			}
+			return i
+		}
+		if h, ok := lb.heaps[i.GetId()]; ok && i.IsAvailable() && h.occupancy() < lowestOccupancy {
+			lowest, lowestOccupancy = i, h.occupancy()
+		}
+	}
+	if lowest == nil && len(candidates) > 0 {
+		lowest = candidates[0]
+	}
+	return lowest
+}
+
+// observeResponse updates the heap model of the instance which answered the
+// request last.
+func (lb *loadBalancer) observeResponse(r *Request) {
+	if lb.heaps == nil || len(r.Hops) == 0 {
+		return
+	}
+	h, ok := lb.heaps[r.Hops[len(r.Hops)-1]]
+	if !ok {
+		return
+	}
+	if r.Status == 503 {
+		h.collected()
+	} else {
+		h.requestServed()
+	}
+}
+
+// RunGCIComparison runs the simulation with the GC-aware scheduler and then
+// its baseline: the same arrivals with scheduler 2, which also warms the
+// inputs up but dispatches regardless of the heap of the instances. Only the
+// GC-aware run notifies the listener. Its results are returned with the
+// BaselineShedHops and the AvoidedShedHops, so the effect of the GC-awareness
+// is not mixed up with the one of warming the inputs up. If any of the runs
+// is cancelled, the results of the GC-aware one are returned as interrupted,
+// without the comparison.
+func RunGCIComparison(ctx context.Context, cfg Config) (Results, error) {
+	var recorded []*recordedInterArrival
+	record := func(ia InterArrival) InterArrival {
+		r := newRecordedInterArrival(ia)
+		recorded = append(recorded, r)
+		return r
+	}
+	cfg.Scheduler = 3
+	if cfg.InterArrival != nil {
+		cfg.InterArrival = record(cfg.InterArrival)
+	}
+	functions := make([]Function, len(cfg.Functions))
+	for n, f := range cfg.Functions {
+		f.InterArrival = record(f.InterArrival)
+		functions[n] = f
+	}
+	cfg.Functions = functions
+	res, err := RunContext(ctx, cfg)
+	if err != nil {
+		return res, err
+	}
+
+	for _, r := range recorded {
+		r.rewind()
+	}
+	godes.Clear()
+	cfg.Scheduler = 2
+	cfg.Listener = discardListener{}
+	baseline, err := RunContext(ctx, cfg)
+	if err != nil {
+		res.Interrupted = true
+		return res, err
+	}
+	res.BaselineShedHops = baseline.ShedHops
+	res.AvoidedShedHops = baseline.ShedHops - res.ShedHops
+	for n := range res.Functions {
+		res.Functions[n].BaselineShedHops = baseline.Functions[n].ShedHops
+		res.Functions[n].AvoidedShedHops = baseline.Functions[n].ShedHops - res.Functions[n].ShedHops
+	}
+	return res, nil
+}
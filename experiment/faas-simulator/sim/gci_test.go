@@ -0,0 +1,203 @@
+package sim
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/agoussia/godes"
+)
+
+func TestNewHeapModel(t *testing.T) {
+	var testData = []struct {
+		desc  string
+		input []InputEntry
+		want  float64
+	}{
+		{"NoShed", []InputEntry{{200, 1, "coldstart", 0, 1}, {200, 0.1, "body", 0, 0.1}}, math.Inf(1)},
+		{"Cycles", []InputEntry{
+			{200, 1, "coldstart", 0, 1},
+			{200, 0.1, "body", 0, 0.1}, {200, 0.1, "body", 0, 0.1}, {503, 0.01, "body", 0, 0.01},
+			{200, 0.1, "body", 0, 0.1}, {200, 0.1, "body", 0, 0.1}, {200, 0.1, "body", 0, 0.1}, {200, 0.1, "body", 0, 0.1},
+			{503, 0.01, "body", 0, 0.01}, {503, 0.01, "body", 0, 0.01}, {200, 0.1, "body", 0, 0.1}}, 3},
+	}
+	for _, d := range testData {
+		t.Run(d.desc, func(t *testing.T) {
+			if got := newHeapModel(d.input).cycle; got != d.want {
+				t.Fatalf("Want: %v, got: %v", d.want, got)
+			}
+		})
+	}
+}
+
+func TestHeapModelCollected(t *testing.T) {
+	h := newHeapModel([]InputEntry{{200, 1, "coldstart", 0, 1}})
+	for j := 0; j < 4; j++ {
+		h.requestServed()
+	}
+	if h.occupancy() != 0 {
+		t.Fatalf("Want: 0 occupancy without an observed collection, got: %v", h.occupancy())
+	}
+	h.collected()
+	h.collected() // shed during the same collection
+	if h.cycle != 4 || h.cycles != 1 || h.served != 0 {
+		t.Fatalf("Want: cycle 4 of 1 collection, got: %+v", h)
+	}
+	for j := 0; j < 2; j++ {
+		h.requestServed()
+	}
+	if h.occupancy() != 0.5 {
+		t.Fatalf("Want: 0.5 occupancy, got: %v", h.occupancy())
+	}
+	h.collected()
+	if h.cycle != 3 {
+		t.Fatalf("Want: cycle 3, got: %v", h.cycle)
+	}
+}
+
+func TestGCISelect(t *testing.T) {
+	input := []InputEntry{
+		{200, 1, "coldstart", 0, 1}, {200, 0.1, "body", 0, 0.1}, {200, 0.1, "body", 0, 0.1}, {503, 0.01, "body", 0, 0.01}}
+	lb := &loadBalancer{
+		scheduler: 3,
+		instances: make([]IInstance, 0),
+		inputs:    [][]InputEntry{input},
+		heaps:     newHeapModels(3),
+	}
+	mru := lb.newInstance(&Request{Status: 200})
+	lru := lb.newInstance(&Request{Status: 200})
+	candidates := []IInstance{mru, lru}
+	if got := lb.gciSelect(candidates); got != mru {
+		t.Fatalf("Want: %s, got: %s", mru.GetId(), got.GetId())
+	}
+
+	// Two served requests complete the cycle of the most recently used one,
+	// which collects while the least recently used one is picked.
+	for j := 0; j < 2; j++ {
+		lb.observeResponse(&Request{Status: 200, Hops: []string{mru.GetId()}})
+	}
+	if got := lb.gciSelect(candidates); got != lru {
+		t.Fatalf("Want: %s, got: %s", lru.GetId(), got.GetId())
+	}
+	if lb.heaps[mru.GetId()].occupancy() != 0 {
+		t.Fatalf("Want: 0 occupancy after collecting, got: %v", lb.heaps[mru.GetId()].occupancy())
+	}
+	if got := lb.gciSelect(candidates); got != mru {
+		t.Fatalf("Want: %s after collecting, got: %s", mru.GetId(), got.GetId())
+	}
+
+	// With every candidate about to collect, the least occupied one is picked.
+	for j := 0; j < 2; j++ {
+		lb.observeResponse(&Request{Status: 200, Hops: []string{lru.GetId()}})
+	}
+	for j := 0; j < 3; j++ {
+		lb.observeResponse(&Request{Status: 200, Hops: []string{mru.GetId()}})
+	}
+	if got := lb.gciSelect(candidates); got != lru {
+		t.Fatalf("Want: %s, got: %s", lru.GetId(), got.GetId())
+	}
+}
+
+func TestInstanceCollect(t *testing.T) {
+	reproducer := newInputReproducer([]InputEntry{
+		{200, 1, "coldstart", 0, 1}, {200, 0.1, "body", 0, 0.1}, {503, 0.01, "0.01:0.02", 0, 0.01}, {200, 0.2, "body", 0, 0.2}}, 0)
+	i := newInstance("i0", &loadBalancer{}, time.Second, reproducer)
+	for _, want := range []float64{1, 0.1} {
+		if _, rt := i.next(); rt != want {
+			t.Fatalf("Want: %v, got: %v", want, rt)
+		}
+	}
+	i.collect()
+	if status, rt := i.next(); status != 200 || rt != 0.2 {
+		t.Fatalf("Want: 200 and 0.2 after collecting, got: %d and %v", status, rt)
+	}
+	if i.getAvoidedSheds() != 1 || i.GetBusyTime() != 0.01 {
+		t.Fatalf("Want: 1 avoided shed taking 0.01 busy, got: %d and %v", i.getAvoidedSheds(), i.GetBusyTime())
+	}
+}
+
+func TestInstanceCollect_Mispredicted(t *testing.T) {
+	reproducer := newInputReproducer([]InputEntry{
+		{200, 0.1, "body", 0, 0.1}, {200, 0.2, "body", 0, 0.2}, {503, 0.01, "0.01:0.02", 0, 0.01}}, 0)
+	i := newInstance("i0", &loadBalancer{}, time.Second, reproducer)
+	i.collect()
+	for _, want := range []struct {
+		status       int
+		responseTime float64
+	}{{200, 0.1}, {200, 0.2}, {503, 0.01}} {
+		// The collection while idle was not followed by a 503 entry, so the
+		// later one is still shed.
+		if status, rt := i.next(); status != want.status || rt != want.responseTime {
+			t.Fatalf("Want: %d and %v, got: %d and %v", want.status, want.responseTime, status, rt)
+		}
+	}
+	if i.getAvoidedSheds() != 0 {
+		t.Fatalf("Want: no avoided shed, got: %d", i.getAvoidedSheds())
+	}
+}
+
+// sequenceInterArrival returns 0.001, 0.002, ... seconds.
+type sequenceInterArrival struct{ n int }
+
+func (s *sequenceInterArrival) next() float64 {
+	s.n++
+	return float64(s.n) / 1000
+}
+
+func TestRecordedInterArrival(t *testing.T) {
+	ria := newRecordedInterArrival(&sequenceInterArrival{})
+	for _, want := range []float64{0.001, 0.002} {
+		if got := ria.next(); got != want {
+			t.Fatalf("Want: %v, got: %v", want, got)
+		}
+	}
+	ria.rewind()
+	// The recorded times are replayed, then new ones are drawn.
+	for _, want := range []float64{0.001, 0.002, 0.003} {
+		if got := ria.next(); got != want {
+			t.Fatalf("Want: %v after the rewind, got: %v", want, got)
+		}
+	}
+}
+
+func TestRunGCIComparison(t *testing.T) {
+	// Starts from a new model, as other tests leave theirs running.
+	godes.Verbose(false)
+	godes.Clear()
+	defer godes.Clear()
+	input := []InputEntry{{200, 0.1, "coldstart", 0, 0.1}}
+	for n := 0; n < 10; n++ {
+		input = append(input, InputEntry{200, 0.005, "body", 0, 0.005}, InputEntry{200, 0.005, "body", 0, 0.005},
+			InputEntry{200, 0.005, "body", 0, 0.005}, InputEntry{503, 0.001, "body", 0, 0.001})
+	}
+	cfg := Config{
+		Duration:         time.Second,
+		IdlenessDeadline: time.Minute,
+		InterArrival:     NewConstantInterArrival(0.004),
+		Entries:          [][]InputEntry{input, input, input},
+	}
+	var finished collector
+	cfg.Listener = &finished
+	res, err := RunGCIComparison(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	if int64(len(finished)) != res.RequestCount {
+		t.Fatalf("Want: only the %d requests of the GC-aware run notified, got: %d", res.RequestCount, len(finished))
+	}
+
+	godes.Clear()
+	cfg.Scheduler = 2
+	cfg.Listener = voidListener{}
+	baseline, err := RunContext(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	if res.BaselineShedHops != baseline.ShedHops || res.AvoidedShedHops != baseline.ShedHops-res.ShedHops {
+		t.Fatalf("Want: %d baseline and %d avoided shed hops, got: %d and %d", baseline.ShedHops, baseline.ShedHops-res.ShedHops, res.BaselineShedHops, res.AvoidedShedHops)
+	}
+	if res.AvoidedShedHops <= 0 || res.IdleCollections <= 0 {
+		t.Fatalf("Want: shed hops avoided by collecting while idle, got: %d avoided and %d idle collections", res.AvoidedShedHops, res.IdleCollections)
+	}
+}
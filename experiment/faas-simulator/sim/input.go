@@ -1,35 +1,66 @@
 package sim
 
+import (
+	"fmt"
+
+	"golang.org/x/exp/rand"
+)
+
 type iInputReproducer interface {
 	next() (int, float64, string, float64, float64)
 }
 
 type inputReproducer struct {
-	index   int
-	warmed  bool
-	entries []InputEntry
+	warmed   bool
+	entries  []InputEntry
+	order    entryOrder
+	newOrder func([]InputEntry) entryOrder
 }
 
 type warmedinputReproducer struct {
-	index   int
 	entries []InputEntry
+	order   entryOrder
 }
 
 func newInputReproducer(input []InputEntry, warmUp int) iInputReproducer {
-	input = append([]InputEntry{input[0]}, input[warmUp + 1:]...) // remove warmUp, but leave the coldstart entry
-	return &inputReproducer{entries: input}
+	return newOrderedInputReproducer(input, warmUp, newSequentialOrder)
 }
 
 func newWarmedInputReproducer(input []InputEntry, warmUp int) iInputReproducer {
+	return newOrderedWarmedInputReproducer(input, warmUp, newSequentialOrder)
+}
+
+// newOrderedInputReproducer creates a reproducer which replays the cold start
+// entry and then the warm entries in the order given by newOrder.
+func newOrderedInputReproducer(input []InputEntry, warmUp int, newOrder func([]InputEntry) entryOrder) iInputReproducer {
+	input = append([]InputEntry{input[0]}, input[warmStart(input, warmUp):]...) // remove warmUp, but leave the coldstart entry
+	return &inputReproducer{entries: input, newOrder: newOrder}
+}
+
+func newOrderedWarmedInputReproducer(input []InputEntry, warmUp int, newOrder func([]InputEntry) entryOrder) iInputReproducer {
 	if len(input) > 1 {
-		input = input[warmUp + 1:] // remove warmUp and coldstart
+		input = input[warmStart(input, warmUp):] // remove warmUp and coldstart
 	}
-	return &warmedinputReproducer{entries: input}
+	return &warmedinputReproducer{entries: input, order: newOrder(input)}
+}
+
+// warmStart returns the index of the first warm entry of the input. Inputs
+// are validated against the warm up by DiscardWarmUp before the simulation,
+// here it is only bounded to keep at least the last entry.
+func warmStart(input []InputEntry, warmUp int) int {
+	if warmUp+1 >= len(input) {
+		return len(input) - 1
+	}
+	return warmUp + 1
 }
 
 func (r *inputReproducer) next() (int, float64, string, float64, float64) {
-	e := r.entries[r.index]
-	r.index = (r.index + 1) % len(r.entries)
+	var e InputEntry
+	if r.warmed {
+		e = r.entries[r.order.next()]
+	} else {
+		e = r.entries[0]
+	}
 	r.setWarm()
 	return e.Status, e.ResponseTime, e.Body, e.TsBefore, e.TsAfter
 }
@@ -39,17 +70,125 @@ func (r *inputReproducer) setWarm() {
 		r.warmed = true
 		if len(r.entries) > 1 {
 			r.entries = r.entries[1:] // remove first entry
-			r.index = 0
 		}
+		r.order = r.newOrder(r.entries)
 	}
 }
 
 func (r *warmedinputReproducer) next() (int, float64, string, float64, float64) {
-	e := r.entries[r.index]
-	r.index = (r.index + 1) % len(r.entries)
+	e := r.entries[r.order.next()]
 	return e.Status, e.ResponseTime, e.Body, e.TsBefore, e.TsAfter
 }
 
+// ReplayStrategy is the order in which the instances replay their warm input
+// entries.
+type ReplayStrategy int
+
+const (
+	// ReplaySequential cycles through the entries in the recorded order.
+	ReplaySequential ReplayStrategy = iota
+	// ReplayRandomOffset cycles through the entries in the recorded order,
+	// starting from a random entry.
+	ReplayRandomOffset
+	// ReplayBootstrap draws the entries uniformly, with replacement.
+	ReplayBootstrap
+	// ReplayBlockBootstrap draws blocks of consecutive entries, with
+	// replacement. Blocks are the GC cycles of the input, each one ending on a
+	// 503 entry, or blocks of a fixed size starting at random entries if the
+	// input has no 503 entry.
+	ReplayBlockBootstrap
+)
+
+var replayStrategyNames = []string{"sequential", "offset", "bootstrap", "block"}
+
+// ParseReplayStrategy parses the name of a replay strategy: sequential,
+// offset, bootstrap or block.
+func ParseReplayStrategy(name string) (ReplayStrategy, error) {
+	for i, n := range replayStrategyNames {
+		if n == name {
+			return ReplayStrategy(i), nil
+		}
+	}
+	return 0, fmt.Errorf("Invalid replay strategy (%s), must be one of %v", name, replayStrategyNames)
+}
+
+func (s ReplayStrategy) String() string {
+	if s < 0 || int(s) >= len(replayStrategyNames) {
+		return fmt.Sprintf("ReplayStrategy(%d)", int(s))
+	}
+	return replayStrategyNames[s]
+}
+
+// entryOrder returns the index of the next entry to replay.
+type entryOrder interface {
+	next() int
+}
+
+type sequentialOrder struct {
+	index int
+	n     int
+}
+
+func newSequentialOrder(entries []InputEntry) entryOrder {
+	return &sequentialOrder{n: len(entries)}
+}
+
+func (o *sequentialOrder) next() int {
+	i := o.index
+	o.index = (o.index + 1) % o.n
+	return i
+}
+
+type bootstrapOrder struct {
+	n   int
+	rnd *rand.Rand
+}
+
+func (o *bootstrapOrder) next() int {
+	return o.rnd.Intn(o.n)
+}
+
+type blockBootstrapOrder struct {
+	n         int
+	starts    []int // first entry of each GC cycle
+	blockSize int   // size of the blocks if there is a single cycle
+	rnd       *rand.Rand
+	pos       int
+	left      int
+}
+
+func newBlockBootstrapOrder(entries []InputEntry, blockSize int, rnd *rand.Rand) entryOrder {
+	starts := []int{0}
+	for i, e := range entries {
+		if e.Status == 503 && i+1 < len(entries) {
+			starts = append(starts, i+1)
+		}
+	}
+	if blockSize < 1 {
+		blockSize = 1
+	}
+	return &blockBootstrapOrder{n: len(entries), starts: starts, blockSize: blockSize, rnd: rnd}
+}
+
+func (o *blockBootstrapOrder) next() int {
+	if o.left == 0 {
+		if len(o.starts) > 1 {
+			b := o.rnd.Intn(len(o.starts))
+			end := o.n
+			if b+1 < len(o.starts) {
+				end = o.starts[b+1]
+			}
+			o.pos, o.left = o.starts[b], end-o.starts[b]
+		} else {
+			o.pos, o.left = o.rnd.Intn(o.n), o.blockSize
+		}
+	}
+	i := o.pos % o.n
+	o.pos++
+	o.left--
+	return i
+}
+
 // InputEntry packs information about one response.
 type InputEntry struct {
 	Status       int
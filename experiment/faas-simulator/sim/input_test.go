@@ -1,8 +1,11 @@
 package sim
 
 import (
+	"fmt"
 	"reflect"
 	"testing"
+
+	"golang.org/x/exp/rand"
 )
 
 func TestInputIReproducer(t *testing.T) {
@@ -48,3 +51,104 @@ func TestInputIReproducer(t *testing.T) {
 		})
 	}
 }
+
+func TestParseReplayStrategy(t *testing.T) {
+	for _, s := range []ReplayStrategy{ReplaySequential, ReplayRandomOffset, ReplayBootstrap, ReplayBlockBootstrap} {
+		got, err := ParseReplayStrategy(s.String())
+		if err != nil || got != s {
+			t.Fatalf("Want: %v, got: %v (%v)", s, got, err)
+		}
+	}
+	if _, err := ParseReplayStrategy("cyclic"); err == nil {
+		t.Fatal("Error expected")
+	}
+}
+
+func TestEntryOrders(t *testing.T) {
+	entries := []InputEntry{
+		{200, 0.2, "", 0, 0}, {503, 0.01, "", 0, 0}, {200, 0.3, "", 0, 0}, {200, 0.4, "", 0, 0}, {503, 0.01, "", 0, 0},
+	}
+	newLB := func(replay ReplayStrategy) *loadBalancer {
+		return &loadBalancer{replay: replay, blockSize: 2, rnd: rand.New(rand.NewSource(1))}
+	}
+
+	o := newLB(ReplayRandomOffset).newEntryOrder(entries)
+	first := o.next()
+	for i := 1; i < 2*len(entries); i++ {
+		if got, want := o.next(), (first+i)%len(entries); got != want {
+			t.Fatalf("Offset - want: %d, got: %d", want, got)
+		}
+	}
+
+	o = newLB(ReplayBootstrap).newEntryOrder(entries)
+	seen := make(map[int]bool)
+	for i := 0; i < 1000; i++ {
+		seen[o.next()] = true
+	}
+	if len(seen) != len(entries) {
+		t.Fatalf("Bootstrap - want all %d entries drawn, got: %v", len(entries), seen)
+	}
+
+	// GC cycles are [0 1] and [2 3 4], every block must be one of them whole.
+	o = newLB(ReplayBlockBootstrap).newEntryOrder(entries)
+	for i := 0; i < 100; i++ {
+		switch start := o.next(); start {
+		case 0:
+			if got := o.next(); got != 1 {
+				t.Fatalf("Block - want: 1, got: %d", got)
+			}
+		case 2:
+			if got := []int{o.next(), o.next()}; !reflect.DeepEqual([]int{3, 4}, got) {
+				t.Fatalf("Block - want: [3 4], got: %v", got)
+			}
+		default:
+			t.Fatalf("Block - want a cycle start, got: %d", start)
+		}
+	}
+
+	// Without 503 entries, blocks have the block size and wrap around.
+	noShed := entries[2:4]
+	o = newLB(ReplayBlockBootstrap).newEntryOrder(noShed)
+	for i := 0; i < 100; i++ {
+		a, b := o.next(), o.next()
+		if b != (a+1)%len(noShed) {
+			t.Fatalf("Fixed block - want consecutive entries, got: %d %d", a, b)
+		}
+	}
+}
+
+func TestRandomFiles(t *testing.T) {
+	lb := &loadBalancer{
+		inputs:      [][]InputEntry{{{200, 1, "", 0, 0}}, {{200, 2, "", 0, 0}}, {{200, 3, "", 0, 0}}},
+		randomFiles: true,
+		rnd:         rand.New(rand.NewSource(1)),
+	}
+	seen := make(map[float64]int)
+	for i := 0; i < 300; i++ {
+		n, input := lb.nextInstanceInputs()
+		if input[0].ResponseTime != float64(n+1) {
+			t.Fatalf("Want: the entries of file %d, got: %v", n, input)
+		}
+		seen[input[0].ResponseTime]++
+	}
+	if len(seen) != 3 {
+		t.Fatalf("Want all 3 files assigned, got: %v", seen)
+	}
+}
+
+func TestRandomFiles_InstanceID(t *testing.T) {
+	lb := &loadBalancer{
+		instances:   make([]IInstance, 0),
+		inputs:      [][]InputEntry{{{200, 1, "", 0, 1}}, {{200, 2, "", 0, 2}}, {{200, 3, "", 0, 3}}},
+		randomFiles: true,
+		rnd:         rand.New(rand.NewSource(1)),
+	}
+	for n := 0; n < 20; n++ {
+		i := lb.newInstance(&Request{Status: 200})
+		_, rt, _, _, _ := i.getReproducer().next()
+		// The file suffix of the id names the file the instance replays.
+		if want := fmt.Sprintf("i%d-f%d", n, int(rt)-1); i.GetId() != want {
+			t.Fatalf("Want: %s replaying an entry of %v, got: %s", want, rt, i.GetId())
+		}
+	}
+}
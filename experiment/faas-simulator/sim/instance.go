@@ -14,6 +14,7 @@ type IInstance interface {
 	IsWorking() bool
 	IsTerminated() bool
 	IsAvailable() bool
+	GetAvailableAt() float64
 	GetLastWorked() float64
 	GetId() string
 	GetBusyTime() float64
@@ -22,6 +23,8 @@ type IInstance interface {
 	GetEfficiency() float64
 	GetCreatedTime() float64
 	getReproducer() iInputReproducer
+	collect()
+	getAvoidedSheds() int64
 }
 
 type instance struct {
@@ -41,6 +44,8 @@ type instance struct {
 	tsAvailableAt    float64   // TimeStamp when the instance becomes available
 	shedRT           []float64 // RT, Response Time
 	shedRTIndex      int
+	collected        bool  // collected its heap while idle, replacing the next entry of its input if it is a collection
+	avoidedSheds     int64 // 503 entries replaced by collections while idle
 }
 
 func newInstance(id string, lb iLoadBalancer, idlenessDeadline time.Duration, reproducer iInputReproducer) *instance {
@@ -101,6 +106,20 @@ func (i *instance) next() (int, float64) {
 		var body string
 		var tsbefore, tsafter float64
 		status, responseTime, body, tsbefore, tsafter = i.reproducer.next()
+		if i.collected {
+			// Only a collection the input was about to have is avoided. If the
+			// next entry is not a 503 the prediction was wrong, and the
+			// collection while idle does not replace a later one.
+			i.collected = false
+			if status == 503 {
+				// The collection already happened while the instance was
+				// idle, taking the time it would have taken to shed the
+				// request.
+				i.busyTime += responseTime
+				i.avoidedSheds++
+				status, responseTime, body, tsbefore, tsafter = i.reproducer.next()
+			}
+		}
 		if status == 503 {
 			i.dealWithTruncatedInput(body, responseTime, tsbefore, tsafter)
 		}
@@ -142,6 +161,11 @@ func (i *instance) IsAvailable() bool {
 	return godes.GetSystemTime() >= i.tsAvailableAt
 }
 
+// GetAvailableAt returns the simulated time when the instance stops shedding requests.
+func (i *instance) GetAvailableAt() float64 {
+	return i.tsAvailableAt
+}
+
 func (i *instance) GetId() string {
 	return i.id
 }
@@ -173,3 +197,13 @@ func (i *instance) GetCreatedTime() float64 {
 func (i *instance) getReproducer() iInputReproducer {
 	return i.reproducer
 }
+
+// collect makes the instance collect its heap while it is out of the dispatch,
+// so the next request does not shed if its entry is a collection.
+func (i *instance) collect() {
+	i.collected = true
+}
+
+func (i *instance) getAvoidedSheds() int64 {
+	return i.avoidedSheds
+}
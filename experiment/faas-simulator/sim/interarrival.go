@@ -27,6 +27,31 @@ func NewPoissonInterArrival(lambda float64) InterArrival {
 		}}
 }
 
+// recordedInterArrival remembers the inter-arrival times it draws, so another
+// simulation can replay the same arrivals after a rewind. Past the recorded
+// ones, it draws new ones.
+type recordedInterArrival struct {
+	ia     InterArrival
+	values []float64
+	pos    int // of the next value to replay
+}
+
+func newRecordedInterArrival(ia InterArrival) *recordedInterArrival {
+	return &recordedInterArrival{ia: ia}
+}
+
+func (ria *recordedInterArrival) next() float64 {
+	if ria.pos == len(ria.values) {
+		ria.values = append(ria.values, ria.ia.next())
+	}
+	ria.pos++
+	return ria.values[ria.pos-1]
+}
+
+func (ria *recordedInterArrival) rewind() {
+	ria.pos = 0
+}
+
 type constantInterArrival struct {
 	value float64
 }
@@ -1,5 +1,109 @@
 package sim
 
+// Listener is notified every time a request is successfully answered.
 type Listener interface {
 	RequestFinished(r *Request)
 }
+
+// InstanceListener is an optional extension of Listener. Listeners that also
+// implement it are notified when instances are created and terminated.
+type InstanceListener interface {
+	InstanceCreated(i IInstance)
+	InstanceTerminated(i IInstance)
+}
+
+// ThrottleListener is an optional extension of Listener. Listeners that also
+// implement it are notified when a request is throttled because there is no
+// capacity left for a new instance. Throttled requests are not finished.
+type ThrottleListener interface {
+	RequestThrottled(r *Request)
+}
+
+// RequestListener is an optional extension of Listener. Listeners that also
+// implement it follow each request through the load balancer: its arrival,
+// every time it is dispatched to an instance and every time an instance sheds it.
+type RequestListener interface {
+	RequestArrived(r *Request)
+	RequestDispatched(r *Request, i IInstance)
+	RequestShed(r *Request, i IInstance)
+}
+
+// discardListener ignores every request, e.g. those of a baseline simulation
+// only run for its results.
+type discardListener struct{}
+
+func (discardListener) RequestFinished(r *Request) {}
+
+type multiListener []Listener
+
+// MultiListener returns a listener that forwards every callback to all the
+// given listeners, in order. Optional callbacks are only forwarded to the
+// listeners that implement them.
+func MultiListener(listeners ...Listener) Listener {
+	var ml multiListener
+	for _, l := range listeners {
+		if l == nil {
+			continue
+		}
+		if inner, ok := l.(multiListener); ok {
+			ml = append(ml, inner...)
+		} else {
+			ml = append(ml, l)
+		}
+	}
+	return ml
+}
+
+func (ml multiListener) RequestFinished(r *Request) {
+	for _, l := range ml {
+		l.RequestFinished(r)
+	}
+}
+
+func (ml multiListener) InstanceCreated(i IInstance) {
+	for _, l := range ml {
+		if il, ok := l.(InstanceListener); ok {
+			il.InstanceCreated(i)
+		}
+	}
+}
+
+func (ml multiListener) InstanceTerminated(i IInstance) {
+	for _, l := range ml {
+		if il, ok := l.(InstanceListener); ok {
+			il.InstanceTerminated(i)
+		}
+	}
+}
+
+func (ml multiListener) RequestThrottled(r *Request) {
+	for _, l := range ml {
+		if tl, ok := l.(ThrottleListener); ok {
+			tl.RequestThrottled(r)
+		}
+	}
+}
+
+func (ml multiListener) RequestArrived(r *Request) {
+	for _, l := range ml {
+		if rl, ok := l.(RequestListener); ok {
+			rl.RequestArrived(r)
+		}
+	}
+}
+
+func (ml multiListener) RequestDispatched(r *Request, i IInstance) {
+	for _, l := range ml {
+		if rl, ok := l.(RequestListener); ok {
+			rl.RequestDispatched(r, i)
+		}
+	}
+}
+
+func (ml multiListener) RequestShed(r *Request, i IInstance) {
+	for _, l := range ml {
+		if rl, ok := l.(RequestListener); ok {
+			rl.RequestShed(r, i)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package sim
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/agoussia/godes"
+)
+
+type eventListener struct{ events []string }
+
+func (l *eventListener) RequestFinished(r *Request) { l.events = append(l.events, "finished") }
+func (l *eventListener) InstanceCreated(i IInstance) {
+	l.events = append(l.events, "created "+i.GetId())
+}
+func (l *eventListener) InstanceTerminated(i IInstance) {
+	l.events = append(l.events, "terminated "+i.GetId())
+}
+func (l *eventListener) RequestThrottled(r *Request) { l.events = append(l.events, "throttled") }
+func (l *eventListener) RequestArrived(r *Request)   { l.events = append(l.events, "arrived") }
+func (l *eventListener) RequestDispatched(r *Request, i IInstance) {
+	l.events = append(l.events, "dispatched "+i.GetId())
+}
+func (l *eventListener) RequestShed(r *Request, i IInstance) {
+	l.events = append(l.events, "shed "+i.GetId())
+}
+
+func TestMultiListener(t *testing.T) {
+	el1, el2 := &eventListener{}, &eventListener{}
+	var finished collector
+	ml := MultiListener(el1, MultiListener(&finished, el2), nil)
+	i := &instance{id: "i0-f0"}
+	req := &Request{ID: 1}
+
+	ml.RequestFinished(req)
+	ml.(InstanceListener).InstanceCreated(i)
+	ml.(RequestListener).RequestArrived(req)
+	ml.(RequestListener).RequestDispatched(req, i)
+	ml.(RequestListener).RequestShed(req, i)
+	ml.(ThrottleListener).RequestThrottled(req)
+	ml.(InstanceListener).InstanceTerminated(i)
+
+	want := []string{"finished", "created i0-f0", "arrived", "dispatched i0-f0", "shed i0-f0", "throttled", "terminated i0-f0"}
+	if !reflect.DeepEqual(want, el1.events) {
+		t.Fatalf("Want: %v, got: %v", want, el1.events)
+	}
+	if !reflect.DeepEqual(want, el2.events) {
+		t.Fatalf("Want: %v, got: %v", want, el2.events)
+	}
+	if len(finished) != 1 {
+		t.Fatalf("Want: %v, got: %v", 1, len(finished))
+	}
+}
+
+type collector []int64
+
+func (c *collector) RequestFinished(r *Request) { *c = append(*c, r.ID) }
+
+func TestLoadBalancerEvents(t *testing.T) {
+	el := &eventListener{}
+	lb := &loadBalancer{
+		arrivalQueue: godes.NewFIFOQueue("arrival"),
+		arrivalCond:  godes.NewBooleanControl(),
+		inputs:       [][]InputEntry{{{200, 0.5, "body", 0, 0.5}}},
+		listener:     el,
+	}
+	req := &Request{}
+	lb.forward(req)
+	lb.dispatch(req)
+	req.Status = 503
+	lb.response(req)
+	req.Status = 200
+	lb.response(req)
+	lb.terminate()
+
+	want := []string{
+		"arrived", "created i0-f0", "dispatched i0-f0",
+		"shed i0-f0", "created i1-f0", "dispatched i1-f0",
+		"finished", "terminated i1-f0", "terminated i0-f0",
+	}
+	if !reflect.DeepEqual(want, el.events) {
+		t.Fatalf("Want: %v, got: %v", want, el.events)
+	}
+}
+
+func TestHistogramListener(t *testing.T) {
+	h := NewHistogramListener([]float64{0.5, 0.1, 1})
+	for _, rt := range []float64{0.05, 0.1, 0.2, 0.7, 1, 3} {
+		h.RequestFinished(&Request{ResponseTime: rt})
+	}
+	want := &HistogramListener{Bounds: []float64{0.1, 0.5, 1}, Counts: []int64{2, 1, 2, 1}}
+	if !reflect.DeepEqual(want, h) {
+		t.Fatalf("Want: %v, got: %v", want, h)
+	}
+}
+
+func TestPercentileListener(t *testing.T) {
+	p := NewPercentileListener(0.01)
+	if !math.IsNaN(p.Quantile(0.5)) {
+		t.Fatalf("Want: NaN, got: %v", p.Quantile(0.5))
+	}
+	for i := 1; i <= 1000; i++ {
+		p.RequestFinished(&Request{ResponseTime: float64(i) / 1000})
+	}
+	var testData = []struct {
+		q    float64
+		want float64
+	}{
+		{0, 0.001}, {0.5, 0.5}, {0.99, 0.99}, {1, 1},
+	}
+	for _, d := range testData {
+		got := p.Quantile(d.q)
+		if math.Abs(got-d.want)/d.want > 0.01 {
+			t.Fatalf("Quantile %v - want: %v, got: %v", d.q, d.want, got)
+		}
+	}
+	if p.Count() != 1000 {
+		t.Fatalf("Want: %v, got: %v", 1000, p.Count())
+	}
+}
+
+func TestInstanceStatsListener(t *testing.T) {
+	s := NewInstanceStatsListener()
+	i0, i1 := &instance{id: "i0-f0"}, &instance{id: "i1-f0", createdTime: 1, terminateTime: 3}
+	s.InstanceCreated(i0)
+	s.InstanceCreated(i1)
+	req := &Request{Hops: []string{"i0-f0"}}
+	s.RequestDispatched(req, i0)
+	s.RequestShed(req, i0)
+	req.Hops = append(req.Hops, "i1-f0")
+	s.RequestDispatched(req, i1)
+	s.RequestFinished(req)
+	s.InstanceTerminated(i1)
+
+	want := map[string]*InstanceStats{
+		"i0-f0": {Dispatched: 1, Shed: 1},
+		"i1-f0": {CreatedTime: 1, TerminatedTime: 3, Terminated: true, Dispatched: 1, Served: 1},
+	}
+	if !reflect.DeepEqual(want, s.Stats) {
+		t.Fatalf("Want: %v, got: %v", want, s.Stats)
+	}
+}
+
+func TestProgressListener(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewProgressListener(&buf, 2)
+	p.InstanceCreated(&instance{})
+	for i := 0; i < 3; i++ {
+		p.RequestFinished(&Request{})
+	}
+	want := "finished requests: 2, live instances: 1\n"
+	if !strings.HasSuffix(buf.String(), want) || strings.Count(buf.String(), "\n") != 1 {
+		t.Fatalf("Want: %q, got: %q", want, buf.String())
+	}
+}
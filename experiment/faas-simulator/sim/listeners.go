@@ -0,0 +1,181 @@
+package sim
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/agoussia/godes"
+)
+
+// HistogramListener counts the response times of finished requests in
+// buckets. Bucket i holds the response times in (Bounds[i-1], Bounds[i]] and
+// the last bucket holds everything above the last bound.
+type HistogramListener struct {
+	Bounds []float64
+	Counts []int64
+}
+
+// NewHistogramListener creates a histogram whose buckets upper bounds, in
+// seconds, are the given ones.
+func NewHistogramListener(bounds []float64) *HistogramListener {
+	b := append([]float64(nil), bounds...)
+	sort.Float64s(b)
+	return &HistogramListener{Bounds: b, Counts: make([]int64, len(b)+1)}
+}
+
+func (h *HistogramListener) RequestFinished(r *Request) {
+	h.Counts[sort.SearchFloat64s(h.Bounds, r.ResponseTime)]++
+}
+
+// PercentileListener keeps a sketch of the response times of finished
+// requests, which answers quantile queries with bounded relative error and
+// memory that grows with the log of the value range instead of the number of
+// requests. Values are stored in buckets whose bounds grow geometrically.
+type PercentileListener struct {
+	gamma     float64
+	logGamma  float64
+	buckets   map[int]int64
+	zeroCount int64
+	count     int64
+}
+
+// NewPercentileListener creates a sketch whose quantiles are within the given
+// relative accuracy (e.g. 0.01 for 1%) of the exact values.
+func NewPercentileListener(relativeAccuracy float64) *PercentileListener {
+	gamma := (1 + relativeAccuracy) / (1 - relativeAccuracy)
+	return &PercentileListener{
+		gamma:    gamma,
+		logGamma: math.Log(gamma),
+		buckets:  make(map[int]int64),
+	}
+}
+
+func (p *PercentileListener) RequestFinished(r *Request) {
+	p.add(r.ResponseTime)
+}
+
+func (p *PercentileListener) add(v float64) {
+	p.count++
+	if v <= 0 {
+		p.zeroCount++
+		return
+	}
+	p.buckets[int(math.Ceil(math.Log(v)/p.logGamma))]++
+}
+
+// Count returns the number of response times seen.
+func (p *PercentileListener) Count() int64 {
+	return p.count
+}
+
+// Quantile returns an estimate of the q-quantile (0 <= q <= 1) of the
+// response times seen. It returns NaN if no request has finished.
+func (p *PercentileListener) Quantile(q float64) float64 {
+	if p.count == 0 || q < 0 || q > 1 {
+		return math.NaN()
+	}
+	rank := int64(q * float64(p.count-1))
+	if rank < p.zeroCount {
+		return 0
+	}
+	keys := make([]int, 0, len(p.buckets))
+	for k := range p.buckets {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	seen := p.zeroCount
+	for _, k := range keys {
+		seen += p.buckets[k]
+		if seen > rank {
+			return 2 * math.Pow(p.gamma, float64(k)) / (p.gamma + 1)
+		}
+	}
+	return 2 * math.Pow(p.gamma, float64(keys[len(keys)-1])) / (p.gamma + 1)
+}
+
+// InstanceStats packs the requests handled by one instance.
+type InstanceStats struct {
+	CreatedTime    float64
+	TerminatedTime float64
+	Terminated     bool
+	Dispatched     int64 // requests sent to the instance
+	Served         int64 // requests answered successfully by the instance
+	Shed           int64 // requests shed by the instance
+}
+
+// InstanceStatsListener collects InstanceStats for every instance created on
+// the simulation, indexed by instance id.
+type InstanceStatsListener struct {
+	Stats map[string]*InstanceStats
+}
+
+func NewInstanceStatsListener() *InstanceStatsListener {
+	return &InstanceStatsListener{Stats: make(map[string]*InstanceStats)}
+}
+
+func (s *InstanceStatsListener) get(id string) *InstanceStats {
+	st, ok := s.Stats[id]
+	if !ok {
+		st = &InstanceStats{}
+		s.Stats[id] = st
+	}
+	return st
+}
+
+func (s *InstanceStatsListener) RequestFinished(r *Request) {
+	if len(r.Hops) > 0 {
+		s.get(r.Hops[len(r.Hops)-1]).Served++
+	}
+}
+
+func (s *InstanceStatsListener) InstanceCreated(i IInstance) {
+	s.get(i.GetId()).CreatedTime = i.GetCreatedTime()
+}
+
+func (s *InstanceStatsListener) InstanceTerminated(i IInstance) {
+	st := s.get(i.GetId())
+	st.Terminated = true
+	st.TerminatedTime = i.GetCreatedTime() + i.GetUpTime()
+}
+
+func (s *InstanceStatsListener) RequestArrived(r *Request) {}
+
+func (s *InstanceStatsListener) RequestDispatched(r *Request, i IInstance) {
+	s.get(i.GetId()).Dispatched++
+}
+
+func (s *InstanceStatsListener) RequestShed(r *Request, i IInstance) {
+	if i != nil {
+		s.get(i.GetId()).Shed++
+	}
+}
+
+// ProgressListener writes a progress line every time a given number of
+// requests finishes, with the simulated time and the number of live instances.
+type ProgressListener struct {
+	w        io.Writer
+	every    int64
+	finished int64
+	live     int
+}
+
+func NewProgressListener(w io.Writer, every int64) *ProgressListener {
+	return &ProgressListener{w: w, every: every}
+}
+
+func (p *ProgressListener) RequestFinished(r *Request) {
+	p.finished++
+	if p.every > 0 && p.finished%p.every == 0 {
+		fmt.Fprintf(p.w, "simulated time: %.3fs, finished requests: %d, live instances: %d\n", godes.GetSystemTime(), p.finished, p.live)
+	}
+}
+
+func (p *ProgressListener) InstanceCreated(i IInstance) {
+	p.live++
+}
+
+func (p *ProgressListener) InstanceTerminated(i IInstance) {
+	p.live--
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/agoussia/godes"
+	"golang.org/x/exp/rand"
 )
 
 type iLoadBalancer interface {
@@ -25,8 +26,30 @@ type loadBalancer struct {
 	index              int
 	listener           Listener
 	finishedReqs       int
+	dispatchedReqs     int64
 	scheduler          int
 	warmUp             int
+	serviceTime        *ServiceTimeModel
+	replay             ReplayStrategy
+	blockSize          int
+	randomFiles        bool
+	rnd                *rand.Rand
+	heaps              map[string]*heapModel // heap model of each instance, with the GC-aware scheduler
+	heapThreshold      float64
+	dispatchStrategy   DispatchStrategy
+	created            []IInstance // instances in their creation order
+	roundRobinNext     int         // index in created the round-robin dispatch starts from
+	name               string      // of the function, prefixing the instances ids
+	memoryMB           int
+	cpus               float64
+	capacity           *sharedCapacity
+	throttledReqs      int64
+	metricsWarmUp      *WarmUpFilter // nil unless the warm up is left out of the metrics
+	warmUpThrottled    int64         // throttled requests which arrived during the warm up left out of the metrics
+	evictions          int64 // instances evicted from their host to make room for new ones
+	snapshot           *SnapshotModel
+	restores           int64 // instances started restoring the snapshot
+	shedHops           int64
 }
 
 func newLoadBalancer(idlenessDeadline time.Duration, inputs [][]InputEntry, listener Listener, scheduler int, warmUp int) *loadBalancer {
@@ -40,15 +63,26 @@ func newLoadBalancer(idlenessDeadline time.Duration, inputs [][]InputEntry, list
 		listener:           listener,
 		scheduler:          scheduler,
 		warmUp:             warmUp,
+		heaps:              newHeapModels(scheduler),
 	}
 }
 
+func newHeapModels(scheduler int) map[string]*heapModel {
+	if scheduler != 3 {
+		return nil
+	}
+	return make(map[string]*heapModel)
+}
+
 func (lb *loadBalancer) forward(r *Request) error {
 	if r == nil {
 		return errors.New("Error while calling the LB's forward method. Request cannot be nil.")
 	}
 	lb.arrivalQueue.Place(r)
 	lb.arrivalCond.Set(true)
+	if l, ok := lb.listener.(RequestListener); ok {
+		l.RequestArrived(r)
+	}
 	return nil
 }
 
@@ -56,73 +90,185 @@ func (lb *loadBalancer) response(r *Request) error {
 	if r == nil {
 		return errors.New("Error while calling the LB's response method. Request cannot be nil.")
 	}
+	lb.observeResponse(r)
 	if r.Status == 200 {
 		lb.listener.RequestFinished(r)
 		lb.finishedReqs++
 	} else {
-		lb.nextInstance(r).receive(r)
+		lb.shedHops++
+		if l, ok := lb.listener.(RequestListener); ok {
+			l.RequestShed(r, lb.findInstance(r.Hops[len(r.Hops)-1]))
+		}
+		lb.dispatch(r)
+	}
+	return nil
+}
+
+// dispatch sends the request to the next instance, notifying the listener.
+// Without capacity left for a new instance, the request is throttled, which
+// is notified apart from the finished requests.
+func (lb *loadBalancer) dispatch(r *Request) {
+	i := lb.nextInstance(r)
+	if i == nil {
+		r.updateStatus(StatusThrottled)
+		lb.throttledReqs++
+		if lb.metricsWarmUp != nil && lb.metricsWarmUp.inWarmUp(r) {
+			lb.warmUpThrottled++
+		}
+		if l, ok := lb.listener.(ThrottleListener); ok {
+			l.RequestThrottled(r)
+		}
+		return
+	}
+	i.receive(r)
+	lb.dispatchedReqs++
+	if l, ok := lb.listener.(RequestListener); ok {
+		l.RequestDispatched(r, i)
+	}
+}
+
+func (lb *loadBalancer) findInstance(id string) IInstance {
+	for _, i := range lb.instances {
+		if i.GetId() == id {
+			return i
+		}
 	}
 	return nil
 }
 
+// terminateInstance terminates the instance, notifying the listener.
+func (lb *loadBalancer) terminateInstance(i IInstance) {
+	if i.IsTerminated() {
+		return
+	}
+	i.terminate()
+	if lb.capacity != nil {
+		lb.capacity.release(i, lb)
+	}
+	if l, ok := lb.listener.(InstanceListener); ok {
+		l.InstanceTerminated(i)
+	}
+}
+
 func (lb *loadBalancer) terminate() {
 	if !lb.isTerminated {
 		for _, i := range lb.instances {
-			i.terminate()
+			lb.terminateInstance(i)
 		}
 		lb.isTerminated = true
 		lb.arrivalCond.Set(true)
 	}
 }
 
-func (lb *loadBalancer) nextInstanceInputs() []InputEntry {
-	input := lb.inputs[lb.index]
+// nextInstanceInputs returns the index of the input file of a new instance and
+// its entries.
+func (lb *loadBalancer) nextInstanceInputs() (int, []InputEntry) {
+	if lb.randomFiles {
+		n := lb.random().Intn(len(lb.inputs))
+		return n, lb.inputs[n]
+	}
+	n := lb.index
 	lb.index = (lb.index + 1) % len(lb.inputs)
-	return input
+	return n, lb.inputs[n]
 }
 
 func (lb *loadBalancer) nextInstance(r *Request) IInstance {
 	var selected IInstance
 	// sorting instances to have the most recently used ones ahead on the array
 	sort.SliceStable(lb.instances, func(i, j int) bool { return lb.instances[i].GetLastWorked() > lb.instances[j].GetLastWorked() })
-	for _, i := range lb.instances {
-		if !i.IsWorking() && !i.IsTerminated() && !r.hasBeenProcessed(i.GetId()) {
-			selected = i
-			break
-		}
+	candidates := lb.candidates(r)
+	if lb.heaps != nil {
+		selected = lb.gciSelect(candidates)
+	} else if len(candidates) > 0 {
+		selected = candidates[0]
 	}
 	if selected == nil {
-		selected = lb.newInstance(r)
+		if selected = lb.newInstance(r); selected == nil {
+			return nil
+		}
 	}
+	lb.dispatched(selected)
 	return selected
 }
 
+// newInstance creates an instance to receive the request, or returns nil if
+// there is no capacity left for it.
 func (lb *loadBalancer) newInstance(r *Request) IInstance {
-	newInstanceId := lb.getNewInstanceID()
-	var reproducer iInputReproducer
-	nextInstanceInput := lb.nextInstanceInputs()
+	var h *host
+	if lb.capacity != nil {
+		var ok bool
+		if h, ok = lb.capacity.acquire(lb); !ok {
+			return nil
+		}
+	}
+	fileIndex, nextInstanceInput := lb.nextInstanceInputs()
+	newInstanceId := lb.getNewInstanceID(fileIndex)
+	var warmed bool
 	switch lb.scheduler {
 	case 1: // Optimized Scheduler
-		if r.Status != 503 {
-			reproducer = newWarmedInputReproducer(nextInstanceInput, lb.warmUp)	
-		} else {
-			reproducer = newInputReproducer(nextInstanceInput, lb.warmUp)	
-		}	
-	case 2: // Optimized Scheduler considering GCI
-		reproducer = newWarmedInputReproducer(nextInstanceInput, lb.warmUp)
+		warmed = r.Status != 503
+	case 2, 3: // Optimized Scheduler considering GCI, and GC-aware Scheduler
+		warmed = true
 	default: // Normal Scheduler
-		reproducer = newInputReproducer(nextInstanceInput, lb.warmUp)
+		warmed = false
+	}
+	var reproducer iInputReproducer
+	switch {
+	case lb.serviceTime != nil:
+		reproducer = newModelReproducer(lb.serviceTime, warmed)
+	case warmed:
+		reproducer = newOrderedWarmedInputReproducer(nextInstanceInput, lb.warmUp, lb.newEntryOrder)
+	default:
+		reproducer = newOrderedInputReproducer(nextInstanceInput, lb.warmUp, lb.newEntryOrder)
+	}
+	if lb.snapshot != nil && !warmed {
+		reproducer = newSnapshotReproducer(reproducer, lb.snapshot)
+		lb.restores++
 	}
 	newInstance := newInstance(newInstanceId, lb, lb.idlenessDeadline, reproducer)
+	if lb.heaps != nil {
+		lb.heaps[newInstanceId] = newHeapModel(nextInstanceInput)
+	}
 	godes.AddRunner(newInstance)
 	// inserts the instance ahead of the array
 	lb.instances = append([]IInstance{newInstance}, lb.instances...)
+	lb.created = append(lb.created, newInstance)
+	if lb.capacity != nil {
+		lb.capacity.place(newInstance, lb, h)
+	}
+	if l, ok := lb.listener.(InstanceListener); ok {
+		l.InstanceCreated(newInstance)
+	}
 	return newInstance
 }
 
-func (lb *loadBalancer) getNewInstanceID() string {
+// newEntryOrder returns the order in which a new instance replays its warm
+// entries, according to the replay strategy.
+func (lb *loadBalancer) newEntryOrder(entries []InputEntry) entryOrder {
+	switch lb.replay {
+	case ReplayRandomOffset:
+		return &sequentialOrder{index: lb.random().Intn(len(entries)), n: len(entries)}
+	case ReplayBootstrap:
+		return &bootstrapOrder{n: len(entries), rnd: lb.random()}
+	case ReplayBlockBootstrap:
+		return newBlockBootstrapOrder(entries, lb.blockSize, lb.random())
+	}
+	return newSequentialOrder(entries)
+}
+
+func (lb *loadBalancer) random() *rand.Rand {
+	if lb.rnd == nil {
+		lb.rnd = rand.New(rand.NewSource(uint64(time.Now().UnixNano())))
+	}
+	return lb.rnd
+}
+
+func (lb *loadBalancer) getNewInstanceID(fileIndex int) string {
 	instanceCount := strconv.Itoa(len(lb.instances))
-	fileId := strconv.Itoa(lb.index)
+	fileId := strconv.Itoa(fileIndex)
+	if lb.name != "" {
+		return lb.name + "-i" + instanceCount + "-f" + fileId
+	}
 	return "i" + instanceCount + "-f" + fileId
 }
 
@@ -132,7 +278,7 @@ func (lb *loadBalancer) Run() {
 		lb.tryScaleDown()
 		if lb.arrivalQueue.Len() > 0 {
 			r := lb.arrivalQueue.Get().(*Request)
-			lb.nextInstance(r).receive(r)
+			lb.dispatch(r)
 		} else {
 			lb.arrivalCond.Set(false)
 			if lb.isTerminated {
@@ -145,7 +291,7 @@ func (lb *loadBalancer) Run() {
 func (lb *loadBalancer) tryScaleDown() {
 	for _, i := range lb.instances {
 		if !i.IsWorking() && godes.GetSystemTime()-i.GetLastWorked() >= lb.idlenessDeadline.Seconds() {
-			i.terminate()
+			lb.terminateInstance(i)
 		}
 	}
 }
@@ -154,6 +300,26 @@ func (lb *loadBalancer) getFinishedReqs() int {
 	return lb.finishedReqs
 }
 
+func (lb *loadBalancer) getLiveInstances() int {
+	live := 0
+	for _, i := range lb.instances {
+		if !i.IsTerminated() {
+			live++
+		}
+	}
+	return live
+}
+
+// getIdleCollections returns the 503 entries the instances replaced by
+// collecting their heap while out of the dispatch.
+func (lb *loadBalancer) getIdleCollections() int64 {
+	var avoided int64
+	for _, i := range lb.instances {
+		avoided += i.getAvoidedSheds()
+	}
+	return avoided
+}
+
 func (lb *loadBalancer) getTotalCost() float64 {
 	var totalCost float64
 	for _, i := range lb.instances {
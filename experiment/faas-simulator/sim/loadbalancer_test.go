@@ -151,7 +151,7 @@ func TestNextInstanceInputs(t *testing.T) {
 	for _, d := range testData {
 		t.Run(d.desc, func(t *testing.T) {
 			for i := 0; i < d.nextCalls; i++ {
-				got := d.lb.nextInstanceInputs()
+				_, got := d.lb.nextInstanceInputs()
 				if !reflect.DeepEqual(d.want[i], got) {
 					t.Fatalf("Want: %v, got: %v", d.want[i], got)
 				}
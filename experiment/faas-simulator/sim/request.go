@@ -7,6 +7,7 @@ type Request struct {
 	ResponseTime float64
 	Hops         []string
 	Responses    []float64
+	Function     string // name of the function on multi-function simulations
 }
 
 func newRequest(id int64, createdTime float64) *Request {
@@ -0,0 +1,409 @@
+package sim
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/exp/rand"
+	"gonum.org/v1/gonum/mathext"
+	"gonum.org/v1/gonum/stat"
+	"gonum.org/v1/gonum/stat/distuv"
+)
+
+// Distribution is a service time distribution, in seconds.
+type Distribution interface {
+	Rand() float64
+	CDF(x float64) float64
+	LogProb(x float64) float64
+}
+
+// Distribution families that can be fitted to the inputs.
+const (
+	FamilyLogNormal = "lognormal"
+	FamilyGamma     = "gamma"
+	FamilyWeibull   = "weibull"
+	FamilyEmpirical = "empirical"
+)
+
+// ParametricFamilies are the families whose goodness of fit can be compared.
+var ParametricFamilies = []string{FamilyLogNormal, FamilyGamma, FamilyWeibull}
+
+// Fit fits a distribution of the given family to the samples, by maximum
+// likelihood for the parametric families and by kernel smoothing for the
+// empirical one.
+func Fit(family string, samples []float64, src rand.Source) (Distribution, error) {
+	if len(samples) < 2 {
+		return nil, fmt.Errorf("Error fitting %s: at least two samples are needed, got %d", family, len(samples))
+	}
+	for _, x := range samples {
+		if x <= 0 {
+			return nil, fmt.Errorf("Error fitting %s: samples must be positive, got %f", family, x)
+		}
+	}
+	switch family {
+	case FamilyLogNormal:
+		logs := make([]float64, len(samples))
+		for i, x := range samples {
+			logs[i] = math.Log(x)
+		}
+		mu, sd := stat.MeanStdDev(logs, nil)
+		n := float64(len(logs))
+		sigma := sd * math.Sqrt((n-1)/n) // maximum likelihood, not the unbiased one
+		return distuv.LogNormal{Mu: mu, Sigma: sigma, Src: src}, nil
+	case FamilyGamma:
+		alpha, beta := fitGamma(samples)
+		return distuv.Gamma{Alpha: alpha, Beta: beta, Src: src}, nil
+	case FamilyWeibull:
+		k, lambda := fitWeibull(samples)
+		return distuv.Weibull{K: k, Lambda: lambda, Src: src}, nil
+	case FamilyEmpirical:
+		return newSmoothedEmpirical(samples, src), nil
+	}
+	return nil, fmt.Errorf("Error fitting: unknown distribution family %s", family)
+}
+
+// fitGamma returns the maximum likelihood shape and rate. The shape starts at
+// the Minka approximation and is refined by Newton's method.
+func fitGamma(samples []float64) (float64, float64) {
+	m, meanLog := 0.0, 0.0
+	for _, x := range samples {
+		m += x
+		meanLog += math.Log(x)
+	}
+	m /= float64(len(samples))
+	meanLog /= float64(len(samples))
+	s := math.Log(m) - meanLog
+	if s <= 0 {
+		// All samples are equal, the distribution is as narrow as it gets.
+		return 1e6, 1e6 / m
+	}
+	alpha := (3 - s + math.Sqrt((s-3)*(s-3)+24*s)) / (12 * s)
+	for i := 0; i < 10; i++ {
+		const h = 1e-6
+		f := math.Log(alpha) - mathext.Digamma(alpha) - s
+		trigamma := (mathext.Digamma(alpha+h) - mathext.Digamma(alpha-h)) / (2 * h)
+		next := alpha - f/(1/alpha-trigamma)
+		if next <= 0 || math.IsNaN(next) {
+			break
+		}
+		alpha = next
+	}
+	return alpha, alpha / m
+}
+
+// fitWeibull returns the maximum likelihood shape and scale. The shape is found
+// by bisection of the profile likelihood equation on samples normalized by
+// their mean, which keeps the powers in range.
+func fitWeibull(samples []float64) (float64, float64) {
+	m := stat.Mean(samples, nil)
+	y := make([]float64, len(samples))
+	meanLog := 0.0
+	for i, x := range samples {
+		y[i] = x / m
+		meanLog += math.Log(y[i])
+	}
+	meanLog /= float64(len(y))
+	g := func(k float64) float64 {
+		var sk, skl float64
+		for _, v := range y {
+			p := math.Pow(v, k)
+			sk += p
+			skl += p * math.Log(v)
+		}
+		return skl/sk - 1/k - meanLog
+	}
+	lo, hi := 0.01, 100.0
+	for i := 0; i < 100; i++ {
+		mid := math.Sqrt(lo * hi)
+		if g(mid) > 0 {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+	k := math.Sqrt(lo * hi)
+	sk := 0.0
+	for _, v := range y {
+		sk += math.Pow(v, k)
+	}
+	return k, m * math.Pow(sk/float64(len(y)), 1/k)
+}
+
+// smoothedEmpirical resamples the samples with a Gaussian kernel, so values
+// not seen on the inputs also show up. Values are reflected at zero to stay
+// positive.
+type smoothedEmpirical struct {
+	samples   []float64 // sorted
+	bandwidth float64
+	rnd       *rand.Rand
+}
+
+func newSmoothedEmpirical(samples []float64, src rand.Source) *smoothedEmpirical {
+	sorted := append([]float64(nil), samples...)
+	sort.Float64s(sorted)
+	// Silverman's rule of thumb.
+	sd := stat.StdDev(sorted, nil)
+	iqr := stat.Quantile(0.75, stat.Empirical, sorted, nil) - stat.Quantile(0.25, stat.Empirical, sorted, nil)
+	spread := sd
+	if iqr > 0 && iqr/1.34 < spread {
+		spread = iqr / 1.34
+	}
+	return &smoothedEmpirical{
+		samples:   sorted,
+		bandwidth: 0.9 * spread * math.Pow(float64(len(sorted)), -0.2),
+		rnd:       rand.New(src),
+	}
+}
+
+func (e *smoothedEmpirical) Rand() float64 {
+	x := e.samples[e.rnd.Intn(len(e.samples))]
+	if v := math.Abs(x + e.rnd.NormFloat64()*e.bandwidth); v > 0 {
+		return v
+	}
+	return x
+}
+
+// CDF is the one of the samples, without smoothing.
+func (e *smoothedEmpirical) CDF(x float64) float64 {
+	return float64(sort.Search(len(e.samples), func(i int) bool { return e.samples[i] > x })) / float64(len(e.samples))
+}
+
+// LogProb is not defined, the empirical distribution is not compared by
+// likelihood.
+func (e *smoothedEmpirical) LogProb(x float64) float64 {
+	return math.NaN()
+}
+
+// ParseDistribution parses a distribution given by its parameters, as
+// lognormal:MU:SIGMA, gamma:ALPHA:BETA (shape and rate) or weibull:K:LAMBDA
+// (shape and scale), for service times in seconds.
+func ParseDistribution(spec string, src rand.Source) (Distribution, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("Error parsing distribution (%s): must be family:param1:param2", spec)
+	}
+	var p [2]float64
+	for i, s := range parts[1:] {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing distribution (%s): %q", spec, err)
+		}
+		p[i] = v
+	}
+	if p[1] <= 0 || (parts[0] != FamilyLogNormal && p[0] <= 0) {
+		return nil, fmt.Errorf("Error parsing distribution (%s): parameters out of range", spec)
+	}
+	switch parts[0] {
+	case FamilyLogNormal:
+		return distuv.LogNormal{Mu: p[0], Sigma: p[1], Src: src}, nil
+	case FamilyGamma:
+		return distuv.Gamma{Alpha: p[0], Beta: p[1], Src: src}, nil
+	case FamilyWeibull:
+		return distuv.Weibull{K: p[0], Lambda: p[1], Src: src}, nil
+	}
+	return nil, fmt.Errorf("Error parsing distribution (%s): unknown family %s", spec, parts[0])
+}
+
+// recordedDistribution always returns the one recorded service time.
+type recordedDistribution float64
+
+// NewRecordedDistribution returns the distribution of a single recorded
+// service time, which stands in for a fitted one when there are too few
+// samples to fit, e.g. the cold start of a single input file.
+func NewRecordedDistribution(x float64) Distribution {
+	return recordedDistribution(x)
+}
+
+func (d recordedDistribution) Rand() float64 {
+	return float64(d)
+}
+
+func (d recordedDistribution) CDF(x float64) float64 {
+	if x < float64(d) {
+		return 0
+	}
+	return 1
+}
+
+func (d recordedDistribution) LogProb(x float64) float64 {
+	if x != float64(d) {
+		return math.Inf(-1)
+	}
+	return 0
+}
+
+// DescribeDistribution returns the family and parameters of a distribution,
+// in the format accepted by ParseDistribution when it is parametric.
+func DescribeDistribution(d Distribution) string {
+	switch v := d.(type) {
+	case distuv.LogNormal:
+		return fmt.Sprintf("%s:%g:%g", FamilyLogNormal, v.Mu, v.Sigma)
+	case distuv.Gamma:
+		return fmt.Sprintf("%s:%g:%g", FamilyGamma, v.Alpha, v.Beta)
+	case distuv.Weibull:
+		return fmt.Sprintf("%s:%g:%g", FamilyWeibull, v.K, v.Lambda)
+	case *smoothedEmpirical:
+		return fmt.Sprintf("%s(n=%d, bandwidth=%g)", FamilyEmpirical, len(v.samples), v.bandwidth)
+	case recordedDistribution:
+		return fmt.Sprintf("recorded(%g)", float64(v))
+	}
+	return fmt.Sprintf("%T", d)
+}
+
+// SampleStats are the moments of the samples. Skewness squared and kurtosis
+// are the coordinates of the samples on a Cullen and Frey graph.
+type SampleStats struct {
+	N        int
+	Mean     float64
+	StdDev   float64
+	Skewness float64
+	Kurtosis float64 // not the excess one, 3 for the normal distribution
+}
+
+// Fitness is how well a fitted distribution describes the samples.
+type Fitness struct {
+	Family        string
+	Dist          Distribution
+	LogLikelihood float64
+	AIC           float64
+	KS            float64 // Kolmogorov-Smirnov statistic
+}
+
+// FitReport packs the fits of every parametric family to the samples, best
+// (lowest AIC) first.
+type FitReport struct {
+	Stats SampleStats
+	Fits  []Fitness
+}
+
+// GoodnessOfFit fits every parametric family to the samples and compares them.
+func GoodnessOfFit(samples []float64, src rand.Source) (FitReport, error) {
+	sorted := append([]float64(nil), samples...)
+	sort.Float64s(sorted)
+	m, sd := stat.MeanStdDev(sorted, nil)
+	report := FitReport{Stats: SampleStats{
+		N:        len(sorted),
+		Mean:     m,
+		StdDev:   sd,
+		Skewness: stat.Skew(sorted, nil),
+		Kurtosis: stat.ExKurtosis(sorted, nil) + 3,
+	}}
+	for _, family := range ParametricFamilies {
+		d, err := Fit(family, sorted, src)
+		if err != nil {
+			return FitReport{}, err
+		}
+		ll := 0.0
+		for _, x := range sorted {
+			ll += d.LogProb(x)
+		}
+		report.Fits = append(report.Fits, Fitness{
+			Family:        family,
+			Dist:          d,
+			LogLikelihood: ll,
+			AIC:           2*2 - 2*ll,
+			KS:            ksStatistic(sorted, d),
+		})
+	}
+	sort.SliceStable(report.Fits, func(i, j int) bool { return report.Fits[i].AIC < report.Fits[j].AIC })
+	return report, nil
+}
+
+// ksStatistic returns the largest distance between the empirical CDF of the
+// sorted samples and the CDF of the distribution.
+func ksStatistic(sorted []float64, d Distribution) float64 {
+	n := float64(len(sorted))
+	dist := 0.0
+	for i, x := range sorted {
+		c := d.CDF(x)
+		dist = math.Max(dist, math.Max(c-float64(i)/n, float64(i+1)/n-c))
+	}
+	return dist
+}
+
+// ServiceTimeModel samples the responses of the instances from distributions
+// instead of replaying the input entries, so long simulations do not loop over
+// the same samples. Warm responses are shed with the rate seen on the inputs,
+// reproducing one of the recorded 503 entries.
+type ServiceTimeModel struct {
+	Cold     Distribution
+	Warm     Distribution
+	ShedRate float64
+	Shed     []InputEntry
+	rnd      *rand.Rand
+}
+
+func NewServiceTimeModel(cold, warm Distribution, shedRate float64, shed []InputEntry, src rand.Source) *ServiceTimeModel {
+	return &ServiceTimeModel{Cold: cold, Warm: warm, ShedRate: shedRate, Shed: shed, rnd: rand.New(src)}
+}
+
+// ColdSamples returns the response times of the cold starts, the first entry
+// of each input.
+func ColdSamples(entries [][]InputEntry) []float64 {
+	var samples []float64
+	for _, in := range entries {
+		if len(in) > 0 && in[0].Status == 200 {
+			samples = append(samples, in[0].ResponseTime)
+		}
+	}
+	return samples
+}
+
+// WarmSamples returns the response times of the successful entries after the
+// cold start. The warm up must have been discarded with DiscardWarmUp.
+func WarmSamples(entries [][]InputEntry) []float64 {
+	var samples []float64
+	for _, in := range entries {
+		for j := 1; j < len(in); j++ {
+			if in[j].Status == 200 {
+				samples = append(samples, in[j].ResponseTime)
+			}
+		}
+	}
+	return samples
+}
+
+// ShedEntries returns the 503 entries after the cold start, and their
+// fraction of those entries. The warm up must have been discarded with
+// DiscardWarmUp.
+func ShedEntries(entries [][]InputEntry) ([]InputEntry, float64) {
+	var shed []InputEntry
+	total := 0
+	for _, in := range entries {
+		for j := 1; j < len(in); j++ {
+			total++
+			if in[j].Status == 503 {
+				shed = append(shed, in[j])
+			}
+		}
+	}
+	if total == 0 {
+		return nil, 0
+	}
+	return shed, float64(len(shed)) / float64(total)
+}
+
+type modelReproducer struct {
+	model  *ServiceTimeModel
+	warmed bool
+}
+
+func newModelReproducer(model *ServiceTimeModel, warmed bool) iInputReproducer {
+	return &modelReproducer{model: model, warmed: warmed}
+}
+
+func (r *modelReproducer) next() (int, float64, string, float64, float64) {
+	m := r.model
+	if !r.warmed {
+		r.warmed = true
+		return 200, m.Cold.Rand(), "", 0, 0
+	}
+	if len(m.Shed) > 0 && m.rnd.Float64() < m.ShedRate {
+		e := m.Shed[m.rnd.Intn(len(m.Shed))]
+		return e.Status, e.ResponseTime, e.Body, e.TsBefore, e.TsAfter
+	}
+	return 200, m.Warm.Rand(), "", 0, 0
+}
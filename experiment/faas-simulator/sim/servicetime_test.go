@@ -0,0 +1,141 @@
+package sim
+
+import (
+	"math"
+	"testing"
+
+	"golang.org/x/exp/rand"
+	"gonum.org/v1/gonum/stat/distuv"
+)
+
+func TestFit(t *testing.T) {
+	src := rand.NewSource(1)
+	var testData = []struct {
+		family string
+		dist   Distribution
+	}{
+		{FamilyLogNormal, distuv.LogNormal{Mu: -1.6, Sigma: 0.2, Src: src}},
+		{FamilyGamma, distuv.Gamma{Alpha: 11, Beta: 54, Src: src}},
+		{FamilyWeibull, distuv.Weibull{K: 1.3, Lambda: 0.22, Src: src}},
+	}
+	for _, d := range testData {
+		t.Run(d.family, func(t *testing.T) {
+			samples := make([]float64, 20000)
+			for i := range samples {
+				samples[i] = d.dist.Rand()
+			}
+			got, err := Fit(d.family, samples, src)
+			if err != nil {
+				t.Fatalf("Error not expected: %q", err)
+			}
+			want := DescribeDistribution(d.dist)
+			// Compare the fitted parameters through their CDF on the samples.
+			for _, x := range []float64{0.1, 0.2, 0.3} {
+				if math.Abs(got.CDF(x)-d.dist.CDF(x)) > 0.02 {
+					t.Fatalf("Want: %s, got: %s", want, DescribeDistribution(got))
+				}
+			}
+			report, err := GoodnessOfFit(samples, src)
+			if err != nil {
+				t.Fatalf("Error not expected: %q", err)
+			}
+			if report.Fits[0].Family != d.family {
+				t.Fatalf("Want: %s as best fit, got: %v", d.family, report.Fits)
+			}
+		})
+	}
+}
+
+func TestFit_Error(t *testing.T) {
+	src := rand.NewSource(1)
+	if _, err := Fit(FamilyGamma, []float64{1}, src); err == nil {
+		t.Fatal("Error expected for a single sample")
+	}
+	if _, err := Fit(FamilyGamma, []float64{1, 0}, src); err == nil {
+		t.Fatal("Error expected for non positive samples")
+	}
+	if _, err := Fit("normal", []float64{1, 2}, src); err == nil {
+		t.Fatal("Error expected for an unknown family")
+	}
+}
+
+func TestSmoothedEmpirical(t *testing.T) {
+	d, err := Fit(FamilyEmpirical, []float64{0.1, 0.2, 0.2, 0.3}, rand.NewSource(1))
+	if err != nil {
+		t.Fatalf("Error not expected: %q", err)
+	}
+	if got := d.CDF(0.2); got != 0.75 {
+		t.Fatalf("Want: 0.75, got: %v", got)
+	}
+	for i := 0; i < 1000; i++ {
+		if v := d.Rand(); v <= 0 || v > 1 {
+			t.Fatalf("Want a positive value close to the samples, got: %v", v)
+		}
+	}
+}
+
+func TestParseDistribution(t *testing.T) {
+	var testData = []struct {
+		spec string
+		ok   bool
+	}{
+		{"lognormal:-1.6:0.2", true},
+		{"gamma:11:54", true},
+		{"weibull:1.3:0.22", true},
+		{"gamma:-1:54", false},
+		{"lognormal:1", false},
+		{"normal:1:1", false},
+		{"weibull:x:1", false},
+	}
+	for _, d := range testData {
+		got, err := ParseDistribution(d.spec, rand.NewSource(1))
+		if (err == nil) != d.ok {
+			t.Fatalf("%s - want ok: %v, got error: %v", d.spec, d.ok, err)
+		}
+		if d.ok && DescribeDistribution(got) != d.spec {
+			t.Fatalf("Want: %s, got: %s", d.spec, DescribeDistribution(got))
+		}
+	}
+}
+
+func TestRecordedDistribution(t *testing.T) {
+	d := NewRecordedDistribution(5)
+	if d.Rand() != 5 || d.CDF(4.9) != 0 || d.CDF(5) != 1 || d.LogProb(5) != 0 || !math.IsInf(d.LogProb(4), -1) {
+		t.Fatalf("Want: the distribution of 5 only, got: %s", DescribeDistribution(d))
+	}
+	if got := DescribeDistribution(d); got != "recorded(5)" {
+		t.Fatalf("Want: recorded(5), got: %s", got)
+	}
+}
+
+func TestModelReproducer(t *testing.T) {
+	entries := [][]InputEntry{
+		{{200, 5, "", 0, 0}, {200, 0.2, "", 0, 0}, {503, 0.001, "0.001:0.002", 1, 2}, {200, 0.3, "", 0, 0}},
+		{{200, 4, "", 0, 0}, {200, 0.25, "", 0, 0}},
+	}
+	if got := ColdSamples(entries); len(got) != 2 || got[0] != 5 || got[1] != 4 {
+		t.Fatalf("Want: [5 4], got: %v", got)
+	}
+	if got := WarmSamples(entries); len(got) != 3 || got[2] != 0.25 {
+		t.Fatalf("Want: [0.2 0.3 0.25], got: %v", got)
+	}
+	shed, rate := ShedEntries(entries)
+	if len(shed) != 1 || rate != 0.25 {
+		t.Fatalf("Want: 1 shed entry with rate 0.25, got: %v %v", shed, rate)
+	}
+
+	cold, _ := ParseDistribution("lognormal:1.6:0.001", rand.NewSource(1))
+	warm, _ := ParseDistribution("lognormal:-1.6:0.001", rand.NewSource(1))
+	m := NewServiceTimeModel(cold, warm, 1, shed, rand.NewSource(1))
+	r := newModelReproducer(m, false)
+	if status, rt, _, _, _ := r.next(); status != 200 || math.Abs(rt-math.Exp(1.6)) > 0.1 {
+		t.Fatalf("Want: cold start, got: %d %v", status, rt)
+	}
+	if status, _, body, _, _ := r.next(); status != 503 || body != "0.001:0.002" {
+		t.Fatalf("Want: the shed entry, got: %d %s", status, body)
+	}
+	m.ShedRate = 0
+	if status, rt, _, _, _ := newModelReproducer(m, true).next(); status != 200 || math.Abs(rt-math.Exp(-1.6)) > 0.01 {
+		t.Fatalf("Want: warm service time, got: %d %v", status, rt)
+	}
+}
@@ -1,6 +1,7 @@
 package sim
 
 import (
+	"context"
 	"time"
 
 	"github.com/agoussia/godes"
@@ -8,35 +9,299 @@ import (
 
 // TODO(david): Document the fields of this struct.
 type Results struct {
-	Instances      []IInstance
-	Cost           float64
-	Efficiency     float64
-	RequestCount   int64
-	SimulationTime int64
+	Instances        []IInstance
+	Cost             float64
+	Efficiency       float64
+	RequestCount     int64
+	SimulationTime   int64
+	SimulatedTime    float64       // simulated seconds reached, smaller than the duration if interrupted
+	Interrupted      bool          // whether the simulation was cancelled before reaching its duration
+	WarmUpRequests   int64         // requests left out of the metrics as warm up, with Config.MetricsWarmUp
+	WarmUpTime       float64       // simulated seconds of warm up left out of the metrics, with Config.MetricsWarmUp
+	ShedHops         int64         // 503 responses, each making a request hop to another instance
+	AvoidedShedHops  int64         // BaselineShedHops minus ShedHops, with RunGCIComparison
+	BaselineShedHops int64         // ShedHops of the baseline of RunGCIComparison, on the same arrivals
+	IdleCollections  int64         // 503 entries the instances of the GC-aware scheduler replaced by collecting while idle
+	Throttled        int64         // requests throttled because there was no capacity left for a new instance
+	WarmUpThrottled  int64         // throttled requests among the WarmUpRequests
+	Evictions        int64         // idle instances evicted from their host to make room for new ones
+	Hosts            []HostResults // with Config.Capacity.Hosts
+	Restores         int64         // instances started restoring a snapshot instead of a cold start
+	SnapshotStorage  float64       // GB-seconds of snapshots stored
+
+	// Functions are the results of each function of a multi-function
+	// simulation, whose aggregate are the other fields.
+	Functions []FunctionResults
+	Fairness  float64 // Jain's index of the fraction of the requests of each function not throttled
+}
+
+// Progress is a snapshot of a running simulation.
+type Progress struct {
+	SimulatedTime    float64       // current simulated time, in seconds
+	Duration         time.Duration // simulated time the simulation will reach
+	RequestCount     int64         // requests arrived so far
+	FinishedRequests int64         // requests successfully answered so far
+	LiveInstances    int           // instances not terminated
+	EventsPerSecond  float64       // arrivals, dispatches and responses processed per wall-clock second since the last report
+	Elapsed          time.Duration // wall-clock time since the simulation started
+}
+
+// Config packs the parameters of a simulation.
+type Config struct {
+	Duration         time.Duration  // simulated time to run
+	IdlenessDeadline time.Duration  // time an instance may be idle until be terminated
+	InterArrival     InterArrival   // time between two requests arrivals
+	Entries          [][]InputEntry // inputs replayed by the instances, one per file
+	Listener         Listener       // notified about the requests and instances
+	Scheduler        int            // 0 normal, 1 optimized, 2 optimized considering GCI and 3 GC-aware
+	WarmUp           WarmUp         // input entries to discard after the cold start
+
+	// MetricsWarmUp leaves the warm up out of the requests notified to the
+	// listener instead of out of the inputs: the first WarmUp.Entries requests
+	// or those arriving in the first WarmUp.Duration of simulated time.
+	MetricsWarmUp bool
+
+	// GCIThreshold is the heap occupancy, as the fraction of the GC cycle an
+	// instance went through, from which the GC-aware scheduler predicts its
+	// next collection is imminent and avoids it. Zero means
+	// DefaultGCIThreshold.
+	GCIThreshold float64
+
+	// ServiceTime, when not nil, is sampled by the instances instead of
+	// replaying the entries.
+	ServiceTime *ServiceTimeModel
+
+	Replay      ReplayStrategy   // order in which the instances replay their warm entries
+	BlockSize   int              // entries per block of the block bootstrap when the inputs have no 503 entry
+	RandomFiles bool             // assign the input files to new instances at random instead of round-robin
+	Dispatch    DispatchStrategy // rule picking the idle instance that receives a request
+
+	MemoryMB int     // memory each instance takes from the Capacity
+	CPUs     float64 // CPUs each instance takes from its host
+
+	// Snapshot, when not nil, replaces the cold start of the instances which
+	// are not warmed by the scheduler.
+	Snapshot *SnapshotModel
+
+	// Functions, when not empty, are simulated instead of the single function
+	// given by InterArrival, Entries, IdlenessDeadline, ServiceTime, MemoryMB,
+	// CPUs and Snapshot, and share the Capacity.
+	Functions []Function
+	Capacity  Capacity
+
+	// Progress, when not nil, is called every ProgressInterval of wall-clock time.
+	Progress         func(Progress)
+	ProgressInterval time.Duration
 }
 
 // Run executes a simulation.
 // TODO(david): document each parameters.
 func Run(duration, idlenessDeadline time.Duration, ia InterArrival, entries [][]InputEntry, listener Listener, scheduler int, warmUp int) Results {
+	res, _ := RunContext(context.Background(), Config{
+		Duration:         duration,
+		IdlenessDeadline: idlenessDeadline,
+		InterArrival:     ia,
+		Entries:          entries,
+		Listener:         listener,
+		Scheduler:        scheduler,
+		WarmUp:           WarmUp{Entries: warmUp},
+	})
+	return res
+}
+
+// RunContext executes a simulation until it reaches the configured duration or
+// the context is done. On cancellation, the requests already in flight are
+// finished, the instances are terminated and the partial results are returned
+// together with the context error. Inputs which do not have warm entries
+// left after the warm up are an error.
+func RunContext(ctx context.Context, cfg Config) (Results, error) {
 	before := time.Now()
-	lb := newLoadBalancer(idlenessDeadline, entries, listener, scheduler, warmUp)
+	functions := cfg.Functions
+	if len(functions) == 0 {
+		functions = []Function{{
+			InterArrival:     cfg.InterArrival,
+			Entries:          cfg.Entries,
+			IdlenessDeadline: cfg.IdlenessDeadline,
+			ServiceTime:      cfg.ServiceTime,
+			MemoryMB:         cfg.MemoryMB,
+			CPUs:             cfg.CPUs,
+			Snapshot:         cfg.Snapshot,
+		}}
+	}
+	if err := validateFunctions(functions, cfg.Capacity); err != nil {
+		return Results{}, err
+	}
+	listener := cfg.Listener
+	var warmUpFilter *WarmUpFilter
+	if cfg.MetricsWarmUp {
+		warmUpFilter = NewWarmUpFilter(cfg.WarmUp, cfg.Listener)
+		listener = warmUpFilter
+	}
+	capacity := newSharedCapacity(cfg.Capacity)
+	lbs := make([]*loadBalancer, len(functions))
+	for n, f := range functions {
+		entries := f.Entries
+		if !cfg.MetricsWarmUp {
+			var err error
+			if entries, err = DiscardWarmUp(f.Entries, cfg.WarmUp); err != nil {
+				return Results{}, err
+			}
+		}
+		lb := newLoadBalancer(f.IdlenessDeadline, entries, listener, cfg.Scheduler, 0)
+		lb.name = f.Name
+		lb.memoryMB = f.MemoryMB
+		lb.cpus = f.CPUs
+		lb.capacity = capacity
+		lb.serviceTime = f.ServiceTime
+		lb.snapshot = f.Snapshot
+		lb.replay = cfg.Replay
+		lb.blockSize = cfg.BlockSize
+		lb.randomFiles = cfg.RandomFiles
+		lb.heapThreshold = cfg.GCIThreshold
+		lb.dispatchStrategy = cfg.Dispatch
+		lb.metricsWarmUp = warmUpFilter
+		capacity.lbs = append(capacity.lbs, lb)
+		lbs[n] = lb
+	}
 	reqID := int64(0)
+	reporter := newProgressReporter(cfg, before)
 
-	godes.AddRunner(lb)
+	for _, lb := range lbs {
+		godes.AddRunner(lb)
+	}
 	godes.Run()
-	for godes.GetSystemTime() < duration.Seconds() {
-		lb.forward(newRequest(reqID, godes.GetSystemTime()))
-		godes.Advance(ia.next())
+	// next holds the arrival time of the next request of each function.
+	next := make([]float64, len(functions))
+	requests := make([]int64, len(functions))
+	warmUpRequests := make([]int64, len(functions))
+	var err error
+	for godes.GetSystemTime() < cfg.Duration.Seconds() {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		now := godes.GetSystemTime()
+		n := earliestArrival(next)
+		r := newRequest(reqID, now)
+		r.Function = functions[n].Name
+		lbs[n].forward(r)
+		requests[n]++
+		if warmUpFilter != nil && warmUpFilter.inWarmUp(r) {
+			warmUpRequests[n]++
+		}
+		ia := functions[n].InterArrival.next()
+		next[n] = now + ia
+		wait := next[earliestArrival(next)] - now
+		if len(functions) == 1 {
+			wait = ia // avoids the rounding of next[n] - now
+		}
+		godes.Advance(wait)
 		reqID++
+		reporter.maybeReport(lbs, reqID)
+	}
+	for _, lb := range lbs {
+		lb.terminate()
 	}
-	lb.terminate()
 	godes.WaitUntilDone()
 
-	return Results{
-		Instances:      lb.instances,
-		Cost:           lb.getTotalCost(),
-		Efficiency:     lb.getTotalEfficiency(),
+	res := Results{
 		RequestCount:   reqID,
 		SimulationTime: time.Since(before).Nanoseconds() / 1000000000,
+		SimulatedTime:  godes.GetSystemTime(),
+		Interrupted:    err != nil,
+	}
+	if warmUpFilter != nil {
+		res.WarmUpRequests = warmUpFilter.WarmUpRequests()
+		if res.WarmUpTime = warmUpFilter.WarmUpTime(); res.WarmUpTime < 0 {
+			res.WarmUpTime = res.SimulatedTime
+		}
+	}
+	var fns []FunctionResults
+	for n, lb := range lbs {
+		f := FunctionResults{Name: functions[n].Name, MemoryMB: functions[n].MemoryMB, Results: Results{
+			Instances:       lb.instances,
+			Cost:            lb.getTotalCost(),
+			Efficiency:      lb.getTotalEfficiency(),
+			RequestCount:    requests[n],
+			SimulationTime:  res.SimulationTime,
+			SimulatedTime:   res.SimulatedTime,
+			Interrupted:     res.Interrupted,
+			WarmUpRequests:  warmUpRequests[n],
+			WarmUpTime:      res.WarmUpTime,
+			ShedHops:        lb.shedHops,
+			IdleCollections: lb.getIdleCollections(),
+			Throttled:       lb.throttledReqs,
+			WarmUpThrottled: lb.warmUpThrottled,
+			Evictions:       lb.evictions,
+			Restores:        lb.restores,
+		}}
+		if snapshot := functions[n].Snapshot; snapshot != nil {
+			f.SnapshotStorage = snapshot.storageGBSeconds(res.SimulatedTime)
+		}
+		res.Instances = append(res.Instances, f.Instances...)
+		res.Cost += f.Cost
+		// The efficiency of a function without instances, e.g. with all its
+		// requests throttled, is undefined.
+		if len(f.Instances) > 0 {
+			res.Efficiency += f.Efficiency * float64(len(f.Instances))
+		}
+		res.ShedHops += f.ShedHops
+		res.IdleCollections += f.IdleCollections
+		res.Throttled += f.Throttled
+		res.WarmUpThrottled += f.WarmUpThrottled
+		res.Evictions += f.Evictions
+		res.Restores += f.Restores
+		res.SnapshotStorage += f.SnapshotStorage
+		fns = append(fns, f)
+	}
+	if len(res.Instances) > 0 {
+		res.Efficiency /= float64(len(res.Instances))
+	}
+	if capacity.cluster != nil {
+		res.Hosts = capacity.cluster.results(res.SimulatedTime)
+	}
+	if len(cfg.Functions) > 0 {
+		res.Functions = fns
+		res.Fairness = fairness(fns)
+	}
+	return res, err
+}
+
+type progressReporter struct {
+	cfg        Config
+	start      time.Time
+	last       time.Time
+	lastEvents int64
+}
+
+func newProgressReporter(cfg Config, start time.Time) *progressReporter {
+	return &progressReporter{cfg: cfg, start: start, last: start}
+}
+
+func (p *progressReporter) maybeReport(lbs []*loadBalancer, reqCount int64) {
+	if p.cfg.Progress == nil || p.cfg.ProgressInterval <= 0 {
+		return
+	}
+	now := time.Now()
+	if now.Sub(p.last) < p.cfg.ProgressInterval {
+		return
+	}
+	var finished, dispatched int64
+	live := 0
+	for _, lb := range lbs {
+		finished += int64(lb.finishedReqs)
+		dispatched += lb.dispatchedReqs
+		live += lb.getLiveInstances()
 	}
+	events := reqCount + dispatched + finished
+	p.cfg.Progress(Progress{
+		SimulatedTime:    godes.GetSystemTime(),
+		Duration:         p.cfg.Duration,
+		RequestCount:     reqCount,
+		FinishedRequests: finished,
+		LiveInstances:    live,
+		EventsPerSecond:  float64(events-p.lastEvents) / now.Sub(p.last).Seconds(),
+		Elapsed:          now.Sub(p.start),
+	})
+	p.last = now
+	p.lastEvents = events
 }
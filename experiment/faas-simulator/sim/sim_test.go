@@ -0,0 +1,94 @@
+package sim
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/agoussia/godes"
+)
+
+func TestProgressReporter(t *testing.T) {
+	var got []Progress
+	cfg := Config{
+		Duration:         time.Hour,
+		Progress:         func(p Progress) { got = append(got, p) },
+		ProgressInterval: time.Second,
+	}
+	lb := &loadBalancer{
+		finishedReqs:   8,
+		dispatchedReqs: 10,
+		instances: []IInstance{
+			&instance{id: "0", cond: godes.NewBooleanControl()},
+			&instance{id: "1", cond: godes.NewBooleanControl(), terminated: true},
+		},
+	}
+	start := time.Now()
+	p := newProgressReporter(cfg, start)
+	p.maybeReport([]*loadBalancer{lb}, 10)
+	if len(got) != 0 {
+		t.Fatalf("Want: no report before the interval, got: %v", got)
+	}
+	p.last = start.Add(-2 * time.Second)
+	p.maybeReport([]*loadBalancer{lb}, 10)
+	if len(got) != 1 {
+		t.Fatalf("Want: 1 report, got: %v", got)
+	}
+	if got[0].RequestCount != 10 || got[0].FinishedRequests != 8 || got[0].LiveInstances != 1 || got[0].Duration != time.Hour {
+		t.Fatalf("Unexpected progress: %+v", got[0])
+	}
+	if got[0].EventsPerSecond <= 0 {
+		t.Fatalf("Want: positive events per second, got: %v", got[0].EventsPerSecond)
+	}
+}
+
+// cancelListener cancels the simulation after it finished some requests.
+type cancelListener struct {
+	finished int
+	after    int
+	cancel   context.CancelFunc
+}
+
+func (l *cancelListener) RequestFinished(r *Request) {
+	if l.finished++; l.finished == l.after {
+		l.cancel()
+	}
+}
+
+func TestRunContext_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// Starts from a new model, as other tests leave theirs running.
+	godes.Verbose(false)
+	godes.Clear()
+	defer godes.Clear()
+	l := &cancelListener{after: 10, cancel: cancel}
+	res, err := RunContext(ctx, Config{
+		Duration:         24 * time.Hour,
+		IdlenessDeadline: time.Minute,
+		InterArrival:     NewConstantInterArrival(0.01),
+		Entries:          [][]InputEntry{{{200, 0.1, "coldstart", 0, 0.1}, {200, 0.005, "body", 0, 0.005}}},
+		Listener:         l,
+	})
+	if err != context.Canceled {
+		t.Fatalf("Want: %q, got: %q", context.Canceled, err)
+	}
+	if !res.Interrupted {
+		t.Fatalf("Want: results interrupted")
+	}
+	if res.SimulatedTime >= (24 * time.Hour).Seconds() {
+		t.Fatalf("Want: simulated time smaller than the duration, got: %v", res.SimulatedTime)
+	}
+	// The requests in flight when cancelled are finished.
+	if res.RequestCount < int64(l.after) || int64(l.finished) != res.RequestCount {
+		t.Fatalf("Want: %d requests finished, got: %d", res.RequestCount, l.finished)
+	}
+	if len(res.Instances) == 0 || res.Cost <= 0 {
+		t.Fatalf("Want: partial results, got: %+v", res)
+	}
+	for _, i := range res.Instances {
+		if !i.IsTerminated() {
+			t.Fatalf("Want: instance %s terminated", i.GetId())
+		}
+	}
+}
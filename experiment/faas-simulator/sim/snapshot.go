@@ -0,0 +1,62 @@
+package sim
+
+// SnapshotModel replaces the cold start of new instances, the first entry of
+// their input, with the restore of a snapshot taken after the function was
+// initialized, as Lambda SnapStart, Firecracker snapshots or CRIU do.
+type SnapshotModel struct {
+	Restore Distribution // restore latency, in seconds
+
+	// Penalty is the extra fraction of the response time of the first successful
+	// request after the restore, e.g. 0.5 for 50% slower, paid while the restored
+	// runtime warms up again (e.g. JIT and page faults). It decays linearly
+	// over the first PenaltyRequests successful requests.
+	Penalty         float64
+	PenaltyRequests int
+
+	SizeMB float64 // of the snapshot, stored during the whole simulation
+}
+
+// penaltyFactor returns the factor of the response time of the n-th
+// successful request, from 1, after the restore.
+func (m *SnapshotModel) penaltyFactor(n int) float64 {
+	if n > m.PenaltyRequests {
+		return 1
+	}
+	return 1 + m.Penalty*float64(m.PenaltyRequests-n+1)/float64(m.PenaltyRequests)
+}
+
+// storageGBSeconds returns the snapshot storage after simulatedTime seconds.
+func (m *SnapshotModel) storageGBSeconds(simulatedTime float64) float64 {
+	return m.SizeMB / 1024 * simulatedTime
+}
+
+// snapshotReproducer reproduces the entries of an instance restored from a
+// snapshot. Its first request takes the restore latency plus a warm entry
+// instead of the cold start entry, whatever its status, as the instance
+// restores before it can answer. The penalty decays over the successful
+// requests, as shed ones do not run the function.
+type snapshotReproducer struct {
+	reproducer iInputReproducer
+	model      *SnapshotModel
+	started    bool // whether the cold start entry was replaced
+	served     int  // successful requests since the restore
+}
+
+func newSnapshotReproducer(r iInputReproducer, m *SnapshotModel) iInputReproducer {
+	return &snapshotReproducer{reproducer: r, model: m}
+}
+
+func (r *snapshotReproducer) next() (int, float64, string, float64, float64) {
+	restore := 0.0
+	if !r.started {
+		r.reproducer.next() // the cold start is replaced by the restore
+		restore = r.model.Restore.Rand()
+		r.started = true
+	}
+	status, responseTime, body, tsbefore, tsafter := r.reproducer.next()
+	if status == 200 {
+		r.served++
+		responseTime *= r.model.penaltyFactor(r.served)
+	}
+	return status, restore + responseTime, body, tsbefore, tsafter
+}
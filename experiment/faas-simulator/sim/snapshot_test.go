@@ -0,0 +1,96 @@
+package sim
+
+import (
+	"math"
+	"testing"
+)
+
+type constantDistribution float64
+
+func (d constantDistribution) Rand() float64 { return float64(d) }
+func (d constantDistribution) CDF(x float64) float64 {
+	if x < float64(d) {
+		return 0
+	}
+	return 1
+}
+func (d constantDistribution) LogProb(x float64) float64 { return 0 }
+
+func TestSnapshotPenaltyFactor(t *testing.T) {
+	m := &SnapshotModel{Penalty: 0.5, PenaltyRequests: 2}
+	for n, want := range []float64{1.5, 1.25, 1, 1} {
+		if got := m.penaltyFactor(n + 1); got != want {
+			t.Fatalf("Want: %v for request %d, got: %v", want, n+1, got)
+		}
+	}
+}
+
+func TestSnapshotReproducer(t *testing.T) {
+	type response struct {
+		status       int
+		responseTime float64
+	}
+	var testData = []struct {
+		desc  string
+		input []InputEntry
+		want  []response
+	}{
+		// The restore replaces the cold start, and the shed entry neither pays
+		// the penalty nor makes it decay.
+		{"ShedAfterFirst", []InputEntry{
+			{200, 5, "coldstart", 0, 5}, {200, 0.2, "body", 0, 0.2}, {503, 0.01, "body", 0, 0.01}, {200, 0.4, "body", 0, 0.4}},
+			[]response{{200, 1 + 0.2*2}, {503, 0.01}, {200, 0.4 * 1.5}, {200, 0.2}}},
+		// The restore is paid by the first request even if it is shed, which
+		// does not make the penalty decay.
+		{"ShedAfterColdStart", []InputEntry{
+			{200, 5, "coldstart", 0, 5}, {503, 0.01, "body", 0, 0.01}, {200, 0.2, "body", 0, 0.2}, {200, 0.4, "body", 0, 0.4}},
+			[]response{{503, 1 + 0.01}, {200, 0.2 * 2}, {200, 0.4 * 1.5}, {503, 0.01}, {200, 0.2}}},
+	}
+	for _, d := range testData {
+		t.Run(d.desc, func(t *testing.T) {
+			m := &SnapshotModel{Restore: constantDistribution(1), Penalty: 1, PenaltyRequests: 2}
+			r := newSnapshotReproducer(newInputReproducer(d.input, 0), m)
+			for n, w := range d.want {
+				status, rt, _, _, _ := r.next()
+				if status != w.status || math.Abs(rt-w.responseTime) > 1e-9 {
+					t.Fatalf("Want: %d and %v for request %d, got: %d and %v", w.status, w.responseTime, n+1, status, rt)
+				}
+			}
+		})
+	}
+}
+
+func TestNewInstance_Snapshot(t *testing.T) {
+	input := []InputEntry{{200, 5, "coldstart", 0, 5}, {200, 0.2, "body", 0, 0.2}}
+	var testData = []struct {
+		desc      string
+		scheduler int
+		status    int // of the request creating the instance
+		want      float64
+		restores  int64
+	}{
+		{"Normal", 0, 200, 1.2, 1},
+		{"WarmedByScheduler", 2, 200, 0.2, 0},
+	}
+	for _, d := range testData {
+		t.Run(d.desc, func(t *testing.T) {
+			lb := &loadBalancer{
+				scheduler: d.scheduler,
+				instances: make([]IInstance, 0),
+				inputs:    [][]InputEntry{input},
+				snapshot:  &SnapshotModel{Restore: constantDistribution(1), PenaltyRequests: 1},
+			}
+			i := lb.newInstance(&Request{Status: d.status})
+			if _, rt, _, _, _ := i.getReproducer().next(); math.Abs(rt-d.want) > 1e-9 || lb.restores != d.restores {
+				t.Fatalf("Want: %v and %d restores, got: %v and %d", d.want, d.restores, rt, lb.restores)
+			}
+		})
+	}
+}
+
+func TestSnapshotStorage(t *testing.T) {
+	m := &SnapshotModel{SizeMB: 512}
+	if got := m.storageGBSeconds(10); got != 5 {
+		t.Fatalf("Want: 5, got: %v", got)
+	}
+}
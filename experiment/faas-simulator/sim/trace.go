@@ -0,0 +1,188 @@
+package sim
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+
+	"github.com/agoussia/godes"
+)
+
+// Track ids used inside the trace processes. The load balancer is process 1
+// and every instance gets its own process, so each instance shows up as one
+// track group with its lifetime, the requests it served and its GCI
+// unavailability windows.
+const (
+	traceLBPid           = 1
+	traceLifetimeTid     = 0
+	traceRequestsTid     = 1
+	traceUnavailableTid  = 2
+	traceMicrosPerSecond = 1e6
+)
+
+// traceEvent is one event of the Chrome trace-event format.
+// Reference: https://docs.google.com/document/d/1CvAClvFfyA5R-PhYUmn5OOQtYMH4h6I0nSsKchNAySU
+type traceEvent struct {
+	Name  string                 `json:"name"`
+	Cat   string                 `json:"cat,omitempty"`
+	Ph    string                 `json:"ph"`
+	Ts    float64                `json:"ts"`
+	Dur   float64                `json:"dur,omitempty"`
+	Pid   int                    `json:"pid"`
+	Tid   int                    `json:"tid"`
+	Scope string                 `json:"s,omitempty"`
+	Args  map[string]interface{} `json:"args,omitempty"`
+}
+
+// TraceListener writes every event of the simulation in the Chrome
+// trace-event JSON format, so a run can be opened in Perfetto or
+// chrome://tracing. Events are streamed to the writer, which must be closed
+// with Close to produce a valid JSON document.
+type TraceListener struct {
+	w             *bufio.Writer
+	enc           *json.Encoder
+	err           error
+	count         int
+	pids          map[string]int
+	serviceStart  map[*Request]float64
+	unavailableTo map[string]float64
+}
+
+func NewTraceListener(w io.Writer) *TraceListener {
+	bw := bufio.NewWriter(w)
+	t := &TraceListener{
+		w:             bw,
+		enc:           json.NewEncoder(bw),
+		pids:          make(map[string]int),
+		serviceStart:  make(map[*Request]float64),
+		unavailableTo: make(map[string]float64),
+	}
+	_, t.err = bw.WriteString(`{"displayTimeUnit":"ms","traceEvents":[` + "\n")
+	t.emitMetadata(traceLBPid, "process_name", "load balancer")
+	t.emitThreadName(traceLBPid, 0, "requests")
+	return t
+}
+
+func (t *TraceListener) emit(e traceEvent) {
+	if t.err != nil {
+		return
+	}
+	if t.count > 0 {
+		if _, t.err = t.w.WriteString(","); t.err != nil {
+			return
+		}
+	}
+	t.count++
+	t.err = t.enc.Encode(e)
+}
+
+func (t *TraceListener) emitMetadata(pid int, name, value string) {
+	t.emit(traceEvent{Name: name, Ph: "M", Pid: pid, Args: map[string]interface{}{"name": value}})
+}
+
+func (t *TraceListener) emitThreadName(pid, tid int, value string) {
+	t.emit(traceEvent{Name: "thread_name", Ph: "M", Pid: pid, Tid: tid, Args: map[string]interface{}{"name": value}})
+}
+
+func (t *TraceListener) emitInstant(name string, pid, tid int, args map[string]interface{}) {
+	t.emit(traceEvent{Name: name, Ph: "i", Ts: godes.GetSystemTime() * traceMicrosPerSecond, Pid: pid, Tid: tid, Scope: "t", Args: args})
+}
+
+func (t *TraceListener) emitSlice(name, cat string, pid, tid int, start, end float64, args map[string]interface{}) {
+	t.emit(traceEvent{
+		Name: name,
+		Cat:  cat,
+		Ph:   "X",
+		Ts:   start * traceMicrosPerSecond,
+		Dur:  (end - start) * traceMicrosPerSecond,
+		Pid:  pid,
+		Tid:  tid,
+		Args: args,
+	})
+}
+
+func (t *TraceListener) pid(i IInstance) int {
+	pid, ok := t.pids[i.GetId()]
+	if !ok {
+		pid = len(t.pids) + traceLBPid + 1
+		t.pids[i.GetId()] = pid
+		t.emitMetadata(pid, "process_name", "instance "+i.GetId())
+		t.emitThreadName(pid, traceLifetimeTid, "lifetime")
+		t.emitThreadName(pid, traceRequestsTid, "requests")
+		t.emitThreadName(pid, traceUnavailableTid, "unavailable")
+	}
+	return pid
+}
+
+func (t *TraceListener) InstanceCreated(i IInstance) {
+	t.emitInstant("spawn", t.pid(i), traceLifetimeTid, nil)
+}
+
+func (t *TraceListener) InstanceTerminated(i IInstance) {
+	end := i.GetCreatedTime() + i.GetUpTime()
+	t.emitSlice("lifetime", "instance", t.pid(i), traceLifetimeTid, i.GetCreatedTime(), end, map[string]interface{}{
+		"busy_time":  i.GetBusyTime(),
+		"efficiency": i.GetEfficiency(),
+	})
+}
+
+func (t *TraceListener) RequestArrived(r *Request) {
+	t.emitInstant("arrival", traceLBPid, 0, map[string]interface{}{"id": r.ID})
+}
+
+func (t *TraceListener) RequestDispatched(r *Request, i IInstance) {
+	t.serviceStart[r] = godes.GetSystemTime()
+	if len(r.Hops) > 1 {
+		t.emitInstant("retry", traceLBPid, 0, map[string]interface{}{"id": r.ID, "hop": len(r.Hops), "instance": i.GetId()})
+	}
+}
+
+func (t *TraceListener) RequestShed(r *Request, i IInstance) {
+	if i == nil {
+		return
+	}
+	start := t.serviceStart[r]
+	t.emitInstant("shed", traceLBPid, 0, map[string]interface{}{"id": r.ID, "instance": i.GetId()})
+	t.emitSlice("shed", "service", t.pid(i), traceRequestsTid, start, godes.GetSystemTime(), t.requestArgs(r))
+	if availableAt := i.GetAvailableAt(); availableAt > start && availableAt > t.unavailableTo[i.GetId()] {
+		t.unavailableTo[i.GetId()] = availableAt
+		t.emitSlice("unavailable", "gci", t.pid(i), traceUnavailableTid, start, availableAt, nil)
+	}
+}
+
+func (t *TraceListener) RequestFinished(r *Request) {
+	if len(r.Hops) == 0 {
+		return
+	}
+	pid, ok := t.pids[r.Hops[len(r.Hops)-1]]
+	if !ok {
+		return
+	}
+	t.emitSlice("request", "service", pid, traceRequestsTid, t.serviceStart[r], godes.GetSystemTime(), t.requestArgs(r))
+	delete(t.serviceStart, r)
+}
+
+func (t *TraceListener) RequestThrottled(r *Request) {
+	t.emitInstant("throttle", traceLBPid, 0, map[string]interface{}{"id": r.ID, "hop": len(r.Hops)})
+	delete(t.serviceStart, r)
+}
+
+func (t *TraceListener) requestArgs(r *Request) map[string]interface{} {
+	return map[string]interface{}{
+		"id":     r.ID,
+		"hop":    len(r.Hops),
+		"status": r.Status,
+	}
+}
+
+// Close finishes the JSON document and flushes it. It returns the first error
+// that happened while writing the trace.
+func (t *TraceListener) Close() error {
+	if t.err == nil {
+		_, t.err = t.w.WriteString("]}\n")
+	}
+	if t.err == nil {
+		t.err = t.w.Flush()
+	}
+	return t.err
+}
@@ -0,0 +1,65 @@
+package sim
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/agoussia/godes"
+)
+
+func TestTraceListener(t *testing.T) {
+	var buf bytes.Buffer
+	tl := NewTraceListener(&buf)
+	i0 := &instance{id: "i0-f0", tsAvailableAt: godes.GetSystemTime() + 0.5}
+	i1 := &instance{id: "i1-f0", terminateTime: 1}
+	req := &Request{ID: 4, Hops: []string{"i0-f0"}, Status: 503}
+
+	tl.InstanceCreated(i0)
+	tl.RequestArrived(req)
+	tl.RequestDispatched(req, i0)
+	tl.RequestShed(req, i0)
+	tl.InstanceCreated(i1)
+	req.Hops = append(req.Hops, "i1-f0")
+	req.Status = 200
+	tl.RequestDispatched(req, i1)
+	tl.RequestFinished(req)
+	tl.InstanceTerminated(i1)
+	if err := tl.Close(); err != nil {
+		t.Fatalf("Error not expected: %q", err)
+	}
+
+	var trace struct {
+		TraceEvents []traceEvent `json:"traceEvents"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &trace); err != nil {
+		t.Fatalf("Invalid trace (%s): %q", buf.String(), err)
+	}
+	type event struct {
+		name string
+		ph   string
+		pid  int
+		tid  int
+	}
+	var got []event
+	for _, e := range trace.TraceEvents {
+		if e.Ph != "M" {
+			got = append(got, event{e.Name, e.Ph, e.Pid, e.Tid})
+		}
+	}
+	want := []event{
+		{"spawn", "i", 2, traceLifetimeTid},
+		{"arrival", "i", traceLBPid, 0},
+		{"shed", "i", traceLBPid, 0},
+		{"shed", "X", 2, traceRequestsTid},
+		{"unavailable", "X", 2, traceUnavailableTid},
+		{"spawn", "i", 3, traceLifetimeTid},
+		{"retry", "i", traceLBPid, 0},
+		{"request", "X", 3, traceRequestsTid},
+		{"lifetime", "X", 3, traceLifetimeTid},
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("Want: %v, got: %v", want, got)
+	}
+}
@@ -0,0 +1,174 @@
+package sim
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// WarmUp is the part of each input, after the cold start, measured while the
+// function was still warming up. It is either a number of entries or a
+// duration of measured time, which is the sum of the response times of the
+// entries after the cold start. The zero value is no warm up.
+type WarmUp struct {
+	Entries  int
+	Duration time.Duration
+}
+
+// ParseWarmUp parses a warm up given as a number of entries, e.g. 500, or as a
+// duration, e.g. 30s.
+func ParseWarmUp(s string) (WarmUp, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		if n < 0 {
+			return WarmUp{}, fmt.Errorf("Invalid warm up (%s), the number of entries can not be negative", s)
+		}
+		return WarmUp{Entries: n}, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return WarmUp{}, fmt.Errorf("Invalid warm up (%s), must be a number of entries or a duration", s)
+	}
+	if d < 0 {
+		return WarmUp{}, fmt.Errorf("Invalid warm up (%s), the duration can not be negative", s)
+	}
+	return WarmUp{Duration: d}, nil
+}
+
+func (w WarmUp) String() string {
+	if w.Duration > 0 {
+		return w.Duration.String()
+	}
+	return fmt.Sprintf("%d entries", w.Entries)
+}
+
+// IsZero returns whether there is no warm up.
+func (w WarmUp) IsZero() bool {
+	return w.Entries <= 0 && w.Duration <= 0
+}
+
+// entries returns the number of entries after the cold start of the input
+// which are in the warm up.
+func (w WarmUp) entries(input []InputEntry) int {
+	if w.Duration <= 0 {
+		return w.Entries
+	}
+	n, measured := 0, 0.0
+	for _, e := range input[1:] {
+		if measured >= w.Duration.Seconds() {
+			break
+		}
+		measured += e.ResponseTime
+		n++
+	}
+	return n
+}
+
+// DiscardWarmUp returns the inputs without their warm up entries, keeping the
+// cold start ones. It fails if an input is empty or if its warm up leaves it
+// without warm entries.
+func DiscardWarmUp(entries [][]InputEntry, w WarmUp) ([][]InputEntry, error) {
+	discarded := make([][]InputEntry, len(entries))
+	for i, input := range entries {
+		if len(input) == 0 {
+			return nil, fmt.Errorf("Error discarding the warm up: input %d is empty", i)
+		}
+		n := w.entries(input)
+		if n == 0 {
+			discarded[i] = input
+			continue
+		}
+		if len(input) <= n+1 {
+			return nil, fmt.Errorf("Error discarding the warm up (%v): input %d has %d entries, %d after the cold start are in the warm up and no warm entry is left", w, i, len(input), n)
+		}
+		discarded[i] = append([]InputEntry{input[0]}, input[n+1:]...)
+	}
+	return discarded, nil
+}
+
+// WarmUpFilter forwards to a listener only the events of the requests which
+// arrive after the warm up of the simulation, so it is left out of the
+// metrics instead of the inputs. The warm up is the first Entries requests or
+// the requests arriving in the first Duration of simulated time. Instance
+// events are always forwarded.
+type WarmUpFilter struct {
+	warmUp   WarmUp
+	listener Listener
+	arrivals int64   // requests arrived during the warm up
+	end      float64 // simulated time the first request after the warm up arrived
+	ended    bool
+}
+
+func NewWarmUpFilter(w WarmUp, l Listener) *WarmUpFilter {
+	return &WarmUpFilter{warmUp: w, listener: l}
+}
+
+func (f *WarmUpFilter) inWarmUp(r *Request) bool {
+	if f.warmUp.Duration > 0 {
+		return r.CreatedTime < f.warmUp.Duration.Seconds()
+	}
+	return r.ID < int64(f.warmUp.Entries)
+}
+
+// WarmUpRequests returns the number of requests arrived during the warm up.
+func (f *WarmUpFilter) WarmUpRequests() int64 {
+	return f.arrivals
+}
+
+// WarmUpTime returns the simulated time the warm up took, which is the arrival
+// time of the first request after it, or -1 if it has not ended.
+func (f *WarmUpFilter) WarmUpTime() float64 {
+	if !f.ended {
+		return -1
+	}
+	return f.end
+}
+
+func (f *WarmUpFilter) RequestFinished(r *Request) {
+	if f.listener != nil && !f.inWarmUp(r) {
+		f.listener.RequestFinished(r)
+	}
+}
+
+func (f *WarmUpFilter) RequestThrottled(r *Request) {
+	if l, ok := f.listener.(ThrottleListener); ok && !f.inWarmUp(r) {
+		l.RequestThrottled(r)
+	}
+}
+
+func (f *WarmUpFilter) InstanceCreated(i IInstance) {
+	if l, ok := f.listener.(InstanceListener); ok {
+		l.InstanceCreated(i)
+	}
+}
+
+func (f *WarmUpFilter) InstanceTerminated(i IInstance) {
+	if l, ok := f.listener.(InstanceListener); ok {
+		l.InstanceTerminated(i)
+	}
+}
+
+func (f *WarmUpFilter) RequestArrived(r *Request) {
+	if f.inWarmUp(r) {
+		f.arrivals++
+		return
+	}
+	if !f.ended {
+		f.ended = true
+		f.end = r.CreatedTime
+	}
+	if l, ok := f.listener.(RequestListener); ok {
+		l.RequestArrived(r)
+	}
+}
+
+func (f *WarmUpFilter) RequestDispatched(r *Request, i IInstance) {
+	if l, ok := f.listener.(RequestListener); ok && !f.inWarmUp(r) {
+		l.RequestDispatched(r, i)
+	}
+}
+
+func (f *WarmUpFilter) RequestShed(r *Request, i IInstance) {
+	if l, ok := f.listener.(RequestListener); ok && !f.inWarmUp(r) {
+		l.RequestShed(r, i)
+	}
+}
@@ -0,0 +1,125 @@
+package sim
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseWarmUp(t *testing.T) {
+	var testData = []struct {
+		desc string
+		s    string
+		want WarmUp
+	}{
+		{"Zero", "0", WarmUp{}},
+		{"Entries", "500", WarmUp{Entries: 500}},
+		{"Duration", "30s", WarmUp{Duration: 30 * time.Second}},
+	}
+	for _, d := range testData {
+		t.Run(d.desc, func(t *testing.T) {
+			got, err := ParseWarmUp(d.s)
+			if err != nil {
+				t.Fatalf("Unexpected error: %q", err)
+			}
+			if got != d.want {
+				t.Fatalf("Want: %+v, got: %+v", d.want, got)
+			}
+		})
+	}
+	for _, s := range []string{"-1", "-2s", "foo", ""} {
+		if _, err := ParseWarmUp(s); err == nil {
+			t.Fatalf("Want error parsing %q", s)
+		}
+	}
+}
+
+func TestDiscardWarmUp(t *testing.T) {
+	input := []InputEntry{
+		{200, 0.8, "body", 0, 0.8}, {200, 0.2, "body", 0, 0.2}, {200, 0.3, "body", 0, 0.3}, {200, 0.4, "body", 0, 0.4}}
+	var testData = []struct {
+		desc   string
+		warmUp WarmUp
+		want   []InputEntry
+	}{
+		{"NoWarmUp", WarmUp{}, input},
+		{"Entries", WarmUp{Entries: 2}, []InputEntry{input[0], input[3]}},
+		{"Duration", WarmUp{Duration: 400 * time.Millisecond}, []InputEntry{input[0], input[3]}},
+		{"DurationOfOneEntry", WarmUp{Duration: 100 * time.Millisecond}, []InputEntry{input[0], input[2], input[3]}},
+	}
+	for _, d := range testData {
+		t.Run(d.desc, func(t *testing.T) {
+			got, err := DiscardWarmUp([][]InputEntry{input}, d.warmUp)
+			if err != nil {
+				t.Fatalf("Unexpected error: %q", err)
+			}
+			if !reflect.DeepEqual(got[0], d.want) {
+				t.Fatalf("Want: %v, got: %v", d.want, got[0])
+			}
+		})
+	}
+}
+
+func TestDiscardWarmUp_Error(t *testing.T) {
+	input := []InputEntry{{200, 0.8, "body", 0, 0.8}, {200, 0.2, "body", 0, 0.2}}
+	var testData = []struct {
+		desc    string
+		entries [][]InputEntry
+		warmUp  WarmUp
+	}{
+		{"EmptyInput", [][]InputEntry{input, {}}, WarmUp{}},
+		{"EntriesLeaveNoWarmEntry", [][]InputEntry{input}, WarmUp{Entries: 1}},
+		{"DurationLeavesNoWarmEntry", [][]InputEntry{input}, WarmUp{Duration: time.Second}},
+	}
+	for _, d := range testData {
+		t.Run(d.desc, func(t *testing.T) {
+			if _, err := DiscardWarmUp(d.entries, d.warmUp); err == nil {
+				t.Fatalf("Want error")
+			}
+		})
+	}
+}
+
+type warmUpTestListener struct {
+	finished, arrived []int64
+}
+
+func (l *warmUpTestListener) RequestFinished(r *Request)                { l.finished = append(l.finished, r.ID) }
+func (l *warmUpTestListener) RequestArrived(r *Request)                 { l.arrived = append(l.arrived, r.ID) }
+func (l *warmUpTestListener) RequestDispatched(r *Request, i IInstance) {}
+func (l *warmUpTestListener) RequestShed(r *Request, i IInstance)       {}
+
+func TestWarmUpFilter(t *testing.T) {
+	var testData = []struct {
+		desc   string
+		warmUp WarmUp
+		want   []int64
+		time   float64
+	}{
+		{"Entries", WarmUp{Entries: 2}, []int64{2, 3}, 1},
+		{"Duration", WarmUp{Duration: 1500 * time.Millisecond}, []int64{3}, 1.5},
+	}
+	for _, d := range testData {
+		t.Run(d.desc, func(t *testing.T) {
+			l := &warmUpTestListener{}
+			f := NewWarmUpFilter(d.warmUp, l)
+			if f.WarmUpTime() != -1 {
+				t.Fatalf("Want: -1 before the warm up ends, got: %f", f.WarmUpTime())
+			}
+			for id, created := range []float64{0, 0.5, 1, 1.5} {
+				r := newRequest(int64(id), created)
+				f.RequestArrived(r)
+				f.RequestFinished(r)
+			}
+			if !reflect.DeepEqual(l.arrived, d.want) || !reflect.DeepEqual(l.finished, d.want) {
+				t.Fatalf("Want: %v, got arrived: %v, finished: %v", d.want, l.arrived, l.finished)
+			}
+			if got := f.WarmUpRequests(); got != int64(4-len(d.want)) {
+				t.Fatalf("Want: %d warm up requests, got: %d", 4-len(d.want), got)
+			}
+			if f.WarmUpTime() != d.time {
+				t.Fatalf("Want: %f, got: %f", d.time, f.WarmUpTime())
+			}
+		})
+	}
+}
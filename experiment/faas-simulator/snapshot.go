@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gcinterceptor/gci-simulator/serverless/sim"
+	"golang.org/x/exp/rand"
+)
+
+// buildSnapshotModel builds the snapshot model of the simulation from the
+// snapshot flags. It returns nil if the cold start entries must be replayed
+// instead.
+func buildSnapshotModel(restoreSpec string, penalty float64, penaltyRequests int, sizeMB float64) (*sim.SnapshotModel, error) {
+	if restoreSpec == "" {
+		return nil, nil
+	}
+	if penalty < 0 || penaltyRequests < 1 || sizeMB < 0 {
+		return nil, fmt.Errorf("Invalid snapshot model, snapshot_penalty and snapshot_size_mb can not be negative and snapshot_penalty_requests must be at least 1")
+	}
+	restore, err := sim.ParseDistribution(restoreSpec, rand.NewSource(uint64(time.Now().Nanosecond())))
+	if err != nil {
+		return nil, fmt.Errorf("Error building the snapshot restore distribution: %q", err)
+	}
+	fmt.Printf("SNAPSHOT MODEL, RESTORE: %s, PENALTY: %.4f OVER %d REQUESTS, SIZE: %.2fMB\n", sim.DescribeDistribution(restore), penalty, penaltyRequests, sizeMB)
+	return &sim.SnapshotModel{Restore: restore, Penalty: penalty, PenaltyRequests: penaltyRequests, SizeMB: sizeMB}, nil
+}
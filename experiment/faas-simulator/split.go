@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// inputColumns are the columns of a simulator input file, in order.
+var inputColumns = []string{"id", "status", "response_time", "body", "tsbefore", "tsafter"}
+
+// containerInput is the input of one instance: the rows served by one
+// container of a concurrent measurement, in arrival order.
+type containerInput struct {
+	container string
+	rows      [][]string // input columns followed by the cold start flag
+}
+
+// runSplit implements the split command, which turns a concurrent measurement
+// with a container id column into one simulator input file per container.
+func runSplit(args []string) error {
+	fs := flag.NewFlagSet("split", flag.ExitOnError)
+	input := fs.String("input", "", "measurement CSV file made by the workload with a container id column")
+	containerColumn := fs.String("container_column", "container", "name of the column that identifies the container that served each request")
+	coldColumn := fs.String("cold_column", "", "name of the column that flags the cold start requests, one of which each container must have. By default the first request of each container is its cold start")
+	outputPrefix := fs.String("output_prefix", "input-", "prefix of the input files written, which are named <prefix><n>.csv with n starting at 1")
+	fs.Parse(args)
+
+	if *input == "" {
+		return fmt.Errorf("Must have a measurement input file!")
+	}
+	f, err := os.Open(*input)
+	if err != nil {
+		return fmt.Errorf("Error opening the file (%s), %q", *input, err)
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return fmt.Errorf("Error parsing csv (%s): %q", *input, err)
+	}
+	if len(records) <= 1 {
+		return fmt.Errorf("Can not split a measurement with no requests: %s", *input)
+	}
+	inputs, dropped, err := splitByContainer(records[0], records[1:], *containerColumn, *coldColumn)
+	if err != nil {
+		return err
+	}
+	for n, in := range inputs {
+		p := fmt.Sprintf("%s%d.csv", *outputPrefix, n+1)
+		if err := writeContainerInput(p, in); err != nil {
+			return err
+		}
+		fmt.Printf("%s: container %s, %d requests\n", p, in.container, len(in.rows))
+	}
+	fmt.Printf("SPLIT %d CONTAINERS, %d REQUESTS WITHOUT CONTAINER DROPPED\n", len(inputs), dropped)
+	return nil
+}
+
+// splitByContainer groups the rows by container, in the order the containers
+// first appear, and sorts the rows of each container by tsbefore. Rows without
+// container, like the ones of failed requests, are dropped and counted. Each
+// row gets a cold start flag, read from the cold column if given or set on the
+// first row of the container otherwise, and the cold start row is moved to the
+// top, as the simulator takes the first input entry as the cold start. With the
+// cold column, a container without a flagged row is an error.
+func splitByContainer(header []string, rows [][]string, containerColumn, coldColumn string) ([]containerInput, int, error) {
+	index := make(map[string]int, len(header))
+	for i, h := range header {
+		index[h] = i
+	}
+	var cols []int
+	for _, c := range append(inputColumns, containerColumn) {
+		i, ok := index[c]
+		if !ok {
+			return nil, 0, fmt.Errorf("Error splitting measurement: column %s not found in header %v", c, header)
+		}
+		cols = append(cols, i)
+	}
+	coldIdx := -1
+	if coldColumn != "" {
+		i, ok := index[coldColumn]
+		if !ok {
+			return nil, 0, fmt.Errorf("Error splitting measurement: column %s not found in header %v", coldColumn, header)
+		}
+		coldIdx = i
+	}
+	tsbeforeIdx, containerIdx := cols[4], cols[len(cols)-1]
+
+	type row struct {
+		fields   []string
+		tsbefore float64
+		cold     bool
+	}
+	byContainer := make(map[string][]row)
+	var order []string
+	dropped := 0
+	for _, r := range rows {
+		if containerIdx >= len(r) || r[containerIdx] == "" {
+			dropped++
+			continue
+		}
+		tsbefore, err := strconv.ParseFloat(r[tsbeforeIdx], 64)
+		if err != nil {
+			return nil, 0, fmt.Errorf("Error parsing tsbefore in row (%v): %q", r, err)
+		}
+		var cold bool
+		if coldIdx >= 0 && coldIdx < len(r) && r[coldIdx] != "" {
+			if cold, err = strconv.ParseBool(r[coldIdx]); err != nil {
+				return nil, 0, fmt.Errorf("Error parsing %s in row (%v): %q", coldColumn, r, err)
+			}
+		}
+		fields := make([]string, len(inputColumns))
+		for i := range inputColumns {
+			if cols[i] < len(r) {
+				fields[i] = r[cols[i]]
+			}
+		}
+		c := r[containerIdx]
+		if _, ok := byContainer[c]; !ok {
+			order = append(order, c)
+		}
+		byContainer[c] = append(byContainer[c], row{fields, tsbefore, cold})
+	}
+
+	inputs := make([]containerInput, 0, len(order))
+	for _, c := range order {
+		rs := byContainer[c]
+		sort.SliceStable(rs, func(i, j int) bool { return rs[i].tsbefore < rs[j].tsbefore })
+		coldAt := 0
+		if coldIdx >= 0 {
+			coldAt = -1
+			for i, r := range rs {
+				if r.cold {
+					coldAt = i
+					break
+				}
+			}
+			if coldAt < 0 {
+				return nil, 0, fmt.Errorf("Error splitting measurement: container %s has no cold start flagged by column %s", c, coldColumn)
+			}
+		}
+		if coldAt > 0 {
+			cold := rs[coldAt]
+			copy(rs[1:coldAt+1], rs[:coldAt])
+			rs[0] = cold
+			coldAt = 0
+		}
+		in := containerInput{container: c}
+		for i, r := range rs {
+			in.rows = append(in.rows, append(r.fields, strconv.FormatBool(i == coldAt)))
+		}
+		inputs = append(inputs, in)
+	}
+	return inputs, dropped, nil
+}
+
+func writeContainerInput(p string, in containerInput) error {
+	f, err := os.Create(p)
+	if err != nil {
+		return fmt.Errorf("Error creating the input file (%s): %q", p, err)
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	w.Write(append(append([]string(nil), inputColumns...), "cold_start"))
+	w.WriteAll(in.rows)
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("Error writing the input file (%s): %q", p, err)
+	}
+	return f.Close()
+}
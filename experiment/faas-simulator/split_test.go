@@ -0,0 +1,83 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitByContainer(t *testing.T) {
+	header := []string{"id", "status", "response_time", "body", "tsbefore", "tsafter", "error", "container", "cold"}
+	rows := [][]string{
+		{"1", "200", "30", "29", "10", "40", "", "w0", "true"},
+		{"2", "200", "35", "34", "12", "47", "", "w1", "true"},
+		{"3", "0", "0", "", "13", "13", "timeout", "", ""},
+		{"5", "503", "1", "0.1:0.2", "50", "51", "", "w1", "false"},
+		{"4", "200", "5", "4", "48", "53", "", "w0", "false"},
+	}
+	want := []containerInput{
+		{"w0", [][]string{
+			{"1", "200", "30", "29", "10", "40", "true"},
+			{"4", "200", "5", "4", "48", "53", "false"},
+		}},
+		{"w1", [][]string{
+			{"2", "200", "35", "34", "12", "47", "true"},
+			{"5", "503", "1", "0.1:0.2", "50", "51", "false"},
+		}},
+	}
+
+	got, dropped, err := splitByContainer(header, rows, "container", "")
+	if err != nil {
+		t.Fatalf("Error not expected: %q", err)
+	}
+	if !reflect.DeepEqual(want, got) || dropped != 1 {
+		t.Fatalf("Want: %v (1 dropped), got: %v (%d dropped)", want, got, dropped)
+	}
+
+	got, _, err = splitByContainer(header, rows, "container", "cold")
+	if err != nil {
+		t.Fatalf("Error not expected: %q", err)
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("Want: %v, got: %v", want, got)
+	}
+}
+
+func TestSplitByContainer_ColdStartFirst(t *testing.T) {
+	header := []string{"id", "status", "response_time", "body", "tsbefore", "tsafter", "container", "cold"}
+	rows := [][]string{
+		{"1", "200", "5", "4", "10", "15", "w0", "false"},
+		{"2", "200", "30", "29", "20", "50", "w0", "true"},
+	}
+	want := []containerInput{{"w0", [][]string{
+		{"2", "200", "30", "29", "20", "50", "true"},
+		{"1", "200", "5", "4", "10", "15", "false"},
+	}}}
+	got, _, err := splitByContainer(header, rows, "container", "cold")
+	if err != nil {
+		t.Fatalf("Error not expected: %q", err)
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("Want: %v, got: %v", want, got)
+	}
+}
+
+func TestSplitByContainer_NoColdStartFlagged(t *testing.T) {
+	header := []string{"id", "status", "response_time", "body", "tsbefore", "tsafter", "container", "cold"}
+	rows := [][]string{
+		{"1", "200", "5", "4", "10", "15", "w0", "true"},
+		{"2", "200", "30", "29", "20", "50", "w1", "false"},
+		{"3", "200", "5", "4", "60", "65", "w1", ""},
+	}
+	_, _, err := splitByContainer(header, rows, "container", "cold")
+	if err == nil || !strings.Contains(err.Error(), "w1") {
+		t.Fatalf("Want error naming container w1, got: %v", err)
+	}
+}
+
+func TestSplitByContainer_MissingColumn(t *testing.T) {
+	header := []string{"id", "status", "response_time", "body", "tsbefore", "tsafter"}
+	if _, _, err := splitByContainer(header, nil, "container", ""); err == nil {
+		t.Fatal("Error expected")
+	}
+}
@@ -0,0 +1,12 @@
+#!/bin/bash
+date
+set -x
+
+echo "ADDR: ${ADDR:=:8080}"
+echo "WORKER_CMD: ${WORKER_CMD:=/tmp/synthetic-func --init_time=1s}"
+echo "IDLENESS: ${IDLENESS:=300s}"
+echo "MAX_WORKERS: ${MAX_WORKERS:=0}"
+echo "COLD_START: ${COLD_START:=0s}"
+
+go build -o /tmp/synthetic-func ../../function/synthetic-func
+go run ../faas-emulator --addr=${ADDR} --worker_cmd="${WORKER_CMD}" --idleness=${IDLENESS} --max_workers=${MAX_WORKERS} --cold_start=${COLD_START}
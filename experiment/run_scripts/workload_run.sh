@@ -9,4 +9,4 @@ echo "NUMBER_OF_REQS: ${NUMBER_OF_REQS:=20000}"
 echo "LAMBDA: ${LAMBDA:=200}"
 echo "TYPE: ${TYPE:=measurement}"
 
-go run ../workload/main.go --target=${TARGET} --exp_id="${TYPE}-lambda${LAMBDA}-${EXPI_ID}.csv" --results_path=${RESULTS_PATH} --nreqs=${NUMBER_OF_REQS} --lambda=${LAMBDA}
+go run ../workload --target=${TARGET} --exp_id="${TYPE}-lambda${LAMBDA}-${EXPI_ID}.csv" --results_path=${RESULTS_PATH} --nreqs=${NUMBER_OF_REQS} --lambda=${LAMBDA}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/exp/rand"
+	"gonum.org/v1/gonum/stat/distuv"
+)
+
+// thinkTime is the distribution of the time a virtual user waits between
+// receiving a response and sending its next request. It is written as
+// kind:params, where kind is one of:
+//
+//	const:100ms          always the given duration
+//	exp:100ms            exponential with the given mean
+//	uniform:50ms:150ms   uniform between the two given durations
+//
+// An empty spec means no think time.
+type thinkTime struct {
+	kind   string
+	params []time.Duration
+}
+
+func parseThinkTime(spec string) (*thinkTime, error) {
+	if spec == "" {
+		return &thinkTime{kind: "const", params: []time.Duration{0}}, nil
+	}
+	fields := strings.Split(spec, ":")
+	t := &thinkTime{kind: fields[0]}
+	for _, f := range fields[1:] {
+		d, err := time.ParseDuration(f)
+		if err != nil {
+			return nil, fmt.Errorf("invalid think time %s: %v", spec, err)
+		}
+		if d < 0 {
+			return nil, fmt.Errorf("invalid think time %s: durations can not be negative", spec)
+		}
+		t.params = append(t.params, d)
+	}
+	want := map[string]int{"const": 1, "exp": 1, "uniform": 2}
+	n, ok := want[t.kind]
+	if !ok {
+		return nil, fmt.Errorf("invalid think time %s: unknown distribution %s, must be const, exp or uniform", spec, t.kind)
+	}
+	if len(t.params) != n {
+		return nil, fmt.Errorf("invalid think time %s: %s takes %d durations", spec, t.kind, n)
+	}
+	if t.kind == "uniform" && t.params[0] > t.params[1] {
+		return nil, fmt.Errorf("invalid think time %s: the minimum is bigger than the maximum", spec)
+	}
+	return t, nil
+}
+
+// sampler returns a function that samples think times. Each virtual user must
+// have its own sampler, as they are not safe for concurrent use.
+func (t *thinkTime) sampler(seed uint64) func() time.Duration {
+	src := rand.NewSource(seed)
+	switch t.kind {
+	case "exp":
+		if t.params[0] == 0 {
+			return func() time.Duration { return 0 }
+		}
+		d := distuv.Exponential{Rate: 1 / float64(t.params[0]), Src: src}
+		return func() time.Duration { return time.Duration(d.Rand()) }
+	case "uniform":
+		d := distuv.Uniform{Min: float64(t.params[0]), Max: float64(t.params[1]), Src: src}
+		return func() time.Duration { return time.Duration(d.Rand()) }
+	default:
+		return func() time.Duration { return t.params[0] }
+	}
+}
+
+// closedLoopWorkload runs vus virtual users, each sending one request at a
+// time and waiting a think time after each response, until nReqs requests are
+// made. The virtual users start evenly spread over the ramp-up period, so the
+// concurrency grows linearly until it reaches vus. With one virtual user and
+// no think time this is the sequential workload.
+func closedLoopWorkload(client *http.Client, mix *requestMix, fields bodyFields, first, nReqs int64, vus int, think *thinkTime, rampUp time.Duration, output *resultWriter, errs *errorCounter) {
+	next := first - 1
+	seed := uint64(time.Now().UnixNano())
+	var wg sync.WaitGroup
+	for vu := 1; vu <= vus; vu++ {
+		wg.Add(1)
+		go func(vu int, thinkTime func() time.Duration) {
+			defer wg.Done()
+			time.Sleep(rampUp * time.Duration(vu-1) / time.Duration(vus))
+			for {
+				id := atomic.AddInt64(&next, 1)
+				if id > nReqs {
+					return
+				}
+				// Closed-loop requests are intended to be sent right away.
+				r := measure(client, mix.choose(), fields, id, vu, time.Time{})
+				errs.add(r.errClass)
+				output.add(r)
+				if r.status != 200 {
+					time.Sleep(10 * time.Millisecond)
+				}
+				time.Sleep(thinkTime())
+			}
+		}(vu, think.sampler(seed+uint64(vu)))
+	}
+	wg.Wait()
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseThinkTime(t *testing.T) {
+	var testData = []struct {
+		desc string
+		spec string
+		want *thinkTime
+	}{
+		{"Empty", "", &thinkTime{kind: "const", params: []time.Duration{0}}},
+		{"Const", "const:100ms", &thinkTime{kind: "const", params: []time.Duration{100 * time.Millisecond}}},
+		{"Exp", "exp:1s", &thinkTime{kind: "exp", params: []time.Duration{time.Second}}},
+		{"Uniform", "uniform:50ms:150ms", &thinkTime{kind: "uniform", params: []time.Duration{50 * time.Millisecond, 150 * time.Millisecond}}},
+	}
+	for _, d := range testData {
+		t.Run(d.desc, func(t *testing.T) {
+			got, err := parseThinkTime(d.spec)
+			if err != nil {
+				t.Fatalf("Unexpected error: %q", err)
+			}
+			if !reflect.DeepEqual(got, d.want) {
+				t.Fatalf("Want: %+v, got: %+v", d.want, got)
+			}
+		})
+	}
+	for _, spec := range []string{"const", "const:1s:2s", "exp:foo", "exp:-1s", "uniform:2s:1s", "uniform:1s", "normal:1s"} {
+		if _, err := parseThinkTime(spec); err == nil {
+			t.Fatalf("Want error parsing %q", spec)
+		}
+	}
+}
+
+func TestThinkTimeSampler(t *testing.T) {
+	var testData = []struct {
+		desc     string
+		spec     string
+		min, max time.Duration
+	}{
+		{"Const", "const:100ms", 100 * time.Millisecond, 100 * time.Millisecond},
+		{"ExpZero", "exp:0s", 0, 0},
+		{"Exp", "exp:100ms", 0, time.Hour},
+		{"Uniform", "uniform:50ms:150ms", 50 * time.Millisecond, 150 * time.Millisecond},
+	}
+	for _, d := range testData {
+		t.Run(d.desc, func(t *testing.T) {
+			tt, err := parseThinkTime(d.spec)
+			if err != nil {
+				t.Fatalf("Unexpected error: %q", err)
+			}
+			sample := tt.sampler(1)
+			for n := 0; n < 100; n++ {
+				if got := sample(); got < d.min || got > d.max {
+					t.Fatalf("Want: think time between %v and %v, got: %v", d.min, d.max, got)
+				}
+			}
+		})
+	}
+}
+
+func TestClosedLoopWorkload_RampUp(t *testing.T) {
+	server := newTestServer(20 * time.Millisecond)
+	defer server.Close()
+	mix, err := singleEndpointMix(server.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	output, path := newTestResultWriter(t)
+	rampUp := 200 * time.Millisecond
+	closedLoopWorkload(server.Client(), mix, nil, 1, 20, 2, &thinkTime{kind: "const", params: []time.Duration{0}}, rampUp, output, newErrorCounter())
+	if err := output.close(); err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+
+	rows := readResults(t, path)
+	if len(rows) != 20 {
+		t.Fatalf("Want: 20 rows, got: %d", len(rows))
+	}
+	// The first request of each virtual user is sent when it starts.
+	firstSent := make(map[int64]int64)
+	for _, row := range rows {
+		vu := parseColumn(t, row, "vu")
+		if sent := parseColumn(t, row, "tsbefore"); firstSent[vu] == 0 || sent < firstSent[vu] {
+			firstSent[vu] = sent
+		}
+		// Closed-loop requests are intended to be sent right away.
+		if parseColumn(t, row, "tsintended") != parseColumn(t, row, "tsbefore") {
+			t.Fatalf("Want: intended time equal to the send time, got row: %v", row)
+		}
+	}
+	if len(firstSent) != 2 {
+		t.Fatalf("Want: requests of 2 virtual users, got: %v", firstSent)
+	}
+	if gap := time.Duration(firstSent[2] - firstSent[1]); gap < rampUp/2 || gap > rampUp {
+		t.Fatalf("Want: the second virtual user started %v after the first, got: %v", rampUp/2, gap)
+	}
+}
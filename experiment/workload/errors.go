@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// Error classes recorded in the error column of failed requests.
+const (
+	errTimeout           = "timeout"
+	errConnectionRefused = "connection_refused"
+	errTLS               = "tls"
+	errBadBody           = "bad_body"
+	errOther             = "other"
+)
+
+func classifyError(err error) string {
+	var netErr net.Error
+	var recordErr tls.RecordHeaderError
+	var certErr *tls.CertificateVerificationError
+	var unknownAuthErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return errTimeout
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return errConnectionRefused
+	case errors.As(err, &recordErr), errors.As(err, &certErr), errors.As(err, &unknownAuthErr),
+		errors.As(err, &hostnameErr), strings.Contains(err.Error(), "tls: "):
+		return errTLS
+	default:
+		return errOther
+	}
+}
+
+// errorCounter counts the failed requests by error class. It is safe for
+// concurrent use.
+type errorCounter struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+func newErrorCounter() *errorCounter {
+	return &errorCounter{counts: make(map[string]int64)}
+}
+
+func (c *errorCounter) add(class string) {
+	if class == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[class]++
+}
+
+func (c *errorCounter) print() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.counts) == 0 {
+		fmt.Println("FAILED REQUESTS: 0")
+		return
+	}
+	classes := make([]string, 0, len(c.counts))
+	var total int64
+	for class, n := range c.counts {
+		classes = append(classes, class)
+		total += n
+	}
+	sort.Strings(classes)
+	fmt.Printf("FAILED REQUESTS: %d\n", total)
+	for _, class := range classes {
+		fmt.Printf("  %s: %d\n", class, c.counts[class])
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestClassifyError(t *testing.T) {
+	var testData = []struct {
+		desc string
+		err  error
+		want string
+	}{
+		{"DeadlineExceeded", &url.Error{Op: "Get", URL: "http://x", Err: context.DeadlineExceeded}, errTimeout},
+		{"NetTimeout", &url.Error{Op: "Get", URL: "http://x", Err: timeoutError{}}, errTimeout},
+		{"ConnectionRefused", &url.Error{Op: "Get", URL: "http://x", Err: &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}}, errConnectionRefused},
+		{"TLSRecordHeader", &url.Error{Op: "Get", URL: "https://x", Err: tls.RecordHeaderError{Msg: "first record does not look like a TLS handshake"}}, errTLS},
+		{"UnknownAuthority", &url.Error{Op: "Get", URL: "https://x", Err: x509.UnknownAuthorityError{}}, errTLS},
+		{"TLSMessage", fmt.Errorf("remote error: tls: handshake failure"), errTLS},
+		{"Other", errors.New("unexpected EOF"), errOther},
+	}
+	for _, d := range testData {
+		t.Run(d.desc, func(t *testing.T) {
+			if got := classifyError(d.err); got != d.want {
+				t.Fatalf("Want: %s, got: %s", d.want, got)
+			}
+		})
+	}
+}
+
+func TestMeasure_Errors(t *testing.T) {
+	slow := newTestServer(100 * time.Millisecond)
+	defer slow.Close()
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	badBody := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("not json"))
+	}))
+	defer badBody.Close()
+	var testData = []struct {
+		desc      string
+		url       string
+		timeout   time.Duration
+		want      string
+		wantReply bool // whether there is a response status
+	}{
+		{"Timeout", slow.URL, 10 * time.Millisecond, errTimeout, false},
+		{"ConnectionRefused", closed.URL, time.Second, errConnectionRefused, false},
+		{"BadBody", badBody.URL, time.Second, errBadBody, true},
+		{"Success", slow.URL, time.Second, "", true},
+	}
+	for _, d := range testData {
+		t.Run(d.desc, func(t *testing.T) {
+			mix, err := singleEndpointMix(d.url)
+			if err != nil {
+				t.Fatalf("Unexpected error: %q", err)
+			}
+			r := measure(&http.Client{Timeout: d.timeout}, mix.choose(), nil, 1, 0, time.Time{})
+			if r.errClass != d.want {
+				t.Fatalf("Want: %q, got: %q", d.want, r.errClass)
+			}
+			if (r.status != 0) != d.wantReply {
+				t.Fatalf("Want response: %v, got status: %d", d.wantReply, r.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// bodyField is a value reported by the function on its response body, like
+// its execution time, GC time, container id, cold start flag or heap usage,
+// which is written to the results as a column of its own.
+type bodyField struct {
+	name string
+	path []string
+}
+
+// bodyFields are the fields extracted from every response body.
+type bodyFields []bodyField
+
+// parseBodyFields parses a comma-separated list of name=path entries. The path
+// is a dot-separated JSON path, optionally starting with "$.", whose segments
+// are object keys or array indexes, e.g. container=meta.container_id or
+// gc=gcs.0.duration.
+func parseBodyFields(spec string) (bodyFields, error) {
+	var fs bodyFields
+	if strings.TrimSpace(spec) == "" {
+		return fs, nil
+	}
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(spec, ",") {
+		kv := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+		if len(kv) != 2 || kv[0] == "" || strings.TrimPrefix(kv[1], "$.") == "" {
+			return nil, fmt.Errorf("body field must be name=path. field: %s", entry)
+		}
+		if seen[kv[0]] {
+			return nil, fmt.Errorf("body field names must be unique. name: %s", kv[0])
+		}
+		seen[kv[0]] = true
+		fs = append(fs, bodyField{name: kv[0], path: strings.Split(strings.TrimPrefix(kv[1], "$."), ".")})
+	}
+	return fs, nil
+}
+
+func (fs bodyFields) header() string {
+	var b strings.Builder
+	for _, f := range fs {
+		b.WriteString("," + f.name)
+	}
+	return b.String()
+}
+
+// extract returns the value of each field in the body, empty for the fields
+// missing on it. String values holding JSON, like the body of a Lambda proxy
+// response, are decoded when the path goes through them.
+func (fs bodyFields) extract(body string) []string {
+	if len(fs) == 0 {
+		return nil
+	}
+	values := make([]string, len(fs))
+	doc, err := decodeJSON(body)
+	if err != nil {
+		return values
+	}
+	for i, f := range fs {
+		values[i] = formatField(lookup(doc, f.path))
+	}
+	return values
+}
+
+func decodeJSON(s string) (interface{}, error) {
+	d := json.NewDecoder(strings.NewReader(s))
+	d.UseNumber()
+	var v interface{}
+	err := d.Decode(&v)
+	return v, err
+}
+
+func lookup(v interface{}, path []string) interface{} {
+	for _, seg := range path {
+		if s, ok := v.(string); ok {
+			decoded, err := decodeJSON(s)
+			if err != nil {
+				return nil
+			}
+			v = decoded
+		}
+		switch node := v.(type) {
+		case map[string]interface{}:
+			v = node[seg]
+		case []interface{}:
+			idx, err := strconv.Atoi(seg)
+			if err != nil || idx < 0 || idx >= len(node) {
+				return nil
+			}
+			v = node[idx]
+		default:
+			return nil
+		}
+	}
+	return v
+}
+
+// formatField formats a JSON value as a CSV field. Objects and arrays are
+// written as JSON, quoted when needed.
+func formatField(v interface{}) string {
+	var s string
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		s = val
+	case json.Number:
+		s = val.String()
+	case bool:
+		s = strconv.FormatBool(val)
+	default:
+		b, err := json.Marshal(val)
+		if err != nil {
+			return ""
+		}
+		s = string(b)
+	}
+	if strings.ContainsAny(s, ",\"\r\n") {
+		s = `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+	}
+	return s
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseBodyFields(t *testing.T) {
+	var testData = []struct {
+		desc string
+		spec string
+		want bodyFields
+	}{
+		{"Empty", " ", nil},
+		{"Key", "cold=cold_start", bodyFields{{"cold", []string{"cold_start"}}}},
+		{"Path", "container=$.meta.container_id, gc=gcs.0.duration", bodyFields{
+			{"container", []string{"meta", "container_id"}},
+			{"gc", []string{"gcs", "0", "duration"}},
+		}},
+	}
+	for _, d := range testData {
+		t.Run(d.desc, func(t *testing.T) {
+			got, err := parseBodyFields(d.spec)
+			if err != nil {
+				t.Fatalf("Unexpected error: %q", err)
+			}
+			if !reflect.DeepEqual(got, d.want) {
+				t.Fatalf("Want: %+v, got: %+v", d.want, got)
+			}
+		})
+	}
+	for _, spec := range []string{"cold", "=cold_start", "cold=", "cold=$.", "a=x,a=y"} {
+		if _, err := parseBodyFields(spec); err == nil {
+			t.Fatalf("Want error parsing %q", spec)
+		}
+	}
+}
+
+func TestBodyFieldsHeader(t *testing.T) {
+	fs, err := parseBodyFields("container=container_id,cold=cold_start")
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	if got := fs.header(); got != ",container,cold" {
+		t.Fatalf("Want: ,container,cold, got: %s", got)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	doc, err := decodeJSON(`{"a": {"b": [10, {"c": "x"}]}, "proxied": "{\"d\": true}", "s": "plain"}`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	var testData = []struct {
+		desc string
+		path []string
+		want string
+	}{
+		{"Object", []string{"a", "b", "1", "c"}, "x"},
+		{"Index", []string{"a", "b", "0"}, "10"},
+		{"JSONString", []string{"proxied", "d"}, "true"},
+		{"Array", []string{"a", "b"}, `"[10,{""c"":""x""}]"`},
+		{"MissingKey", []string{"a", "z"}, ""},
+		{"IndexOutOfRange", []string{"a", "b", "2"}, ""},
+		{"NegativeIndex", []string{"a", "b", "-1"}, ""},
+		{"NotAnIndex", []string{"a", "b", "c"}, ""},
+		{"PlainString", []string{"s", "x"}, ""},
+		{"ThroughNumber", []string{"a", "b", "0", "x"}, ""},
+	}
+	for _, d := range testData {
+		t.Run(d.desc, func(t *testing.T) {
+			if got := formatField(lookup(doc, d.path)); got != d.want {
+				t.Fatalf("Want: %s, got: %s", d.want, got)
+			}
+		})
+	}
+}
+
+func TestBodyFieldsExtract(t *testing.T) {
+	fs, err := parseBodyFields("gc=gc_time_ns,heap=heap_bytes,msg=message")
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	var testData = []struct {
+		desc string
+		body string
+		want []string
+	}{
+		{"AllFields", `{"message": "a,b", "gc_time_ns": 1500000000000000000001, "heap_bytes": 42}`, []string{"1500000000000000000001", "42", `"a,b"`}},
+		{"MissingFields", `{"message": "ok"}`, []string{"", "", "ok"}},
+		{"NotJSON", `oops`, []string{"", "", ""}},
+	}
+	for _, d := range testData {
+		t.Run(d.desc, func(t *testing.T) {
+			if got := fs.extract(d.body); !reflect.DeepEqual(got, d.want) {
+				t.Fatalf("Want: %v, got: %v", d.want, got)
+			}
+		})
+	}
+	if got := bodyFields(nil).extract(`{"a": 1}`); got != nil {
+		t.Fatalf("Want: no values without fields, got: %v", got)
+	}
+}
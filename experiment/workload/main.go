@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bufio"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -9,6 +8,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
@@ -19,9 +19,19 @@ import (
 var (
 	expId       = flag.String("exp_id", "test", "Experiment's ID, default value is test")
 	target      = flag.String("target", "", "function's ip and port separated as host:port. There's no default value and should not start with http")
+	mixPath     = flag.String("mix", "", "path of a JSON file with the request mix: a list of endpoints with name, url, method, headers, body template and weight. Replaces the target")
 	nReqs       = flag.Int64("nreqs", 10, "number of requests, default 10000")
-	lambda      = flag.Float64("lambda", 0.0, "Poisson's lambda value. Lambda 0 means sequential workload, default 0")
+	lambda      = flag.Float64("lambda", 0.0, "Poisson's lambda value. Lambda 0 means closed-loop workload, which is sequential with the default number of virtual users, default 0")
+	vus         = flag.Int("vus", 1, "number of virtual users of the closed-loop workload, each one waits for its response before sending the next request. Default 1")
+	think       = flag.String("think", "", "think time of the closed-loop virtual users between a response and their next request: const:D, exp:MEAN or uniform:MIN:MAX. There's no think time by default")
+	replayPath  = flag.String("replay", "", "path of a measurement CSV (tsbefore column) or simulator requests CSV (created_time column) whose arrivals are replayed. The number of requests is the number of arrivals, unless nreqs is set")
+	replayScale = flag.Float64("replay_scale", 1, "factor applied to the time between the replayed arrivals, e.g. 2 replays the trace two times slower. Default 1")
+	rampUp      = flag.Duration("rampup", 0, "period over which the closed-loop virtual users are started, evenly spread. All start at once by default")
 	resultsPath = flag.String("results_path", "", "absolute path for save results made. It has no default value")
+	timeout     = flag.Duration("timeout", 30*time.Second, "timeout of each request, including reading the response body. Default 30s")
+	appendRes   = flag.Bool("append", false, "append the results to the results file if it already exists. By default an existing results file is an error")
+	resume      = flag.Bool("resume", false, "resume a crashed workload from the last checkpointed request of the results file")
+	fieldsSpec  = flag.String("fields", "", "comma-separated name=path list of values reported by the function on the response body, extracted by JSON path into columns of their own, e.g. container=container_id,cold=cold_start,gc=gc_time_ns")
 )
 
 func main() {
@@ -30,34 +40,87 @@ func main() {
 	if err := checkWorkloadFlags(); err != nil {
 		log.Fatalf("invalid flags: %v", err)
 	}
+	thinkTime, err := parseThinkTime(*think)
+	if err != nil {
+		log.Fatalf("invalid flags: %v", err)
+	}
+	var mix *requestMix
+	if *mixPath != "" {
+		mix, err = readRequestMix(*mixPath)
+	} else {
+		mix, err = singleEndpointMix(*target)
+	}
+	if err != nil {
+		log.Fatalf("invalid flags: %v", err)
+	}
 
-	output := make([]string, *nReqs+1)
-	output[0] = fmt.Sprintf("id,status,response_time,body,tsbefore,tsafter")
+	fields, err := parseBodyFields(*fieldsSpec)
+	if err != nil {
+		log.Fatalf("invalid flags: %v", err)
+	}
 
-	fmt.Println("RUNNING WORKLOAD...")
-	if *lambda == 0 {
-		if err := sequentialWorkload(*target, *nReqs, output); err != nil {
-			log.Fatal(err)
+	var replayOffsets []time.Duration
+	if *replayPath != "" {
+		replayOffsets, err = readArrivalTrace(*replayPath, *replayScale)
+		if err != nil {
+			log.Fatalf("invalid flags: %v", err)
 		}
-	} else {
-		if err := poissonWorkload(*target, *nReqs, *lambda, output); err != nil {
-			log.Fatal(err)
+		if !isFlagSet("nreqs") || *nReqs > int64(len(replayOffsets)) {
+			*nReqs = int64(len(replayOffsets))
 		}
 	}
 
+	output, first, err := newResultWriter(*resultsPath+*expId, resultHeader+fields.header(), *appendRes, *resume)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if first > *nReqs {
+		fmt.Printf("NOTHING TO RESUME, ALL %d REQUESTS WERE ALREADY MADE\n", *nReqs)
+		return
+	}
+	if first > 1 {
+		fmt.Printf("RESUMING WORKLOAD FROM REQUEST %d\n", first)
+	}
+
+	client := &http.Client{Timeout: *timeout}
+	errs := newErrorCounter()
+	fmt.Println("RUNNING WORKLOAD...")
+	switch {
+	case *replayPath != "":
+		fmt.Printf("REPLAYING %d ARRIVALS OF %s\n", *nReqs, *replayPath)
+		openLoopWorkload(client, mix, fields, first, *nReqs, NewReplayInterArrival(replayOffsets, first), output, errs)
+	case *lambda != 0:
+		openLoopWorkload(client, mix, fields, first, *nReqs, NewPoissonInterArrival(*lambda), output, errs)
+	default:
+		closedLoopWorkload(client, mix, fields, first, *nReqs, *vus, thinkTime, *rampUp, output, errs)
+	}
+	errs.print()
+
 	fmt.Println("SAVING RESULTS...")
-	if err := createCsv(output, *resultsPath, *expId); err != nil {
+	if err := output.close(); err != nil {
 		log.Fatal(err)
 	}
+}
 
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
 }
 
 func checkWorkloadFlags() error {
 	if len(*expId) <= 0 {
 		return fmt.Errorf("expID must exist. expID: %s", *expId)
 	}
-	if len(*target) <= 0 {
-		return fmt.Errorf("target must exist. target: %s", *target)
+	if len(*target) <= 0 && len(*mixPath) <= 0 {
+		return fmt.Errorf("target or mix must exist. target: %s", *target)
+	}
+	if *timeout <= 0 {
+		return fmt.Errorf("timeout must be bigger than zero. timeout: %v", *timeout)
 	}
 	if *nReqs <= 0 {
 		return fmt.Errorf("nReqs must be bigger than zero. nReqs: %d", *nReqs)
@@ -65,27 +128,19 @@ func checkWorkloadFlags() error {
 	if _, err := os.Stat(*resultsPath); os.IsNotExist(err) {
 		return fmt.Errorf("resultsPath must exist. resultsPath: %s", *resultsPath)
 	}
-
-	return nil
-}
-
-func sequentialWorkload(target string, nReqs int64, output []string) error {
-	for i := int64(1); i <= nReqs; i++ {
-		status, responseTime, body, tsbefore, tsafter, err := sendReq(target)
-		if err != nil {
-			return err
-		}
-
-		body, err = getValueFromBodyMessage(body)
-		if err != nil {
-			return err
-		}
-
-		output[i] = fmt.Sprintf("%d,%d,%d,%s,%d,%d", i, status, responseTime, body, tsbefore, tsafter)
-		if status != 200 {
-			time.Sleep(10 * time.Millisecond)
-		}
+	if *replayScale <= 0 {
+		return fmt.Errorf("replay_scale must be bigger than zero. replay_scale: %f", *replayScale)
+	}
+	if *vus <= 0 {
+		return fmt.Errorf("vus must be bigger than zero. vus: %d", *vus)
+	}
+	if *rampUp < 0 {
+		return fmt.Errorf("rampup can not be negative. rampup: %v", *rampUp)
 	}
+	if *appendRes && *resume {
+		return fmt.Errorf("append and resume can not be used together")
+	}
+
 	return nil
 }
 
@@ -109,41 +164,135 @@ func NewPoissonInterArrival(lambda float64) InterArrival {
 		}}
 }
 
-func poissonWorkload(target string, nReqs int64, lambda float64, output []string) error {
-	p := NewPoissonInterArrival(lambda)
+// openLoopWorkload is an open-loop workload, such as Poisson arrivals or the
+// replay of a trace. Each request has an intended send time, which is the sum
+// of the inter-arrival times so far, and the scheduler sleeps until that
+// absolute time instead of sleeping the inter-arrival time, so late wake-ups do
+// not accumulate. Requests are sent regardless of the
+// previous ones having finished, and their latency is also measured from the
+// intended send time, which corrects the coordinated omission of a target that
+// delays the workload itself.
+func openLoopWorkload(client *http.Client, mix *requestMix, fields bodyFields, first, nReqs int64, p InterArrival, output *resultWriter, errs *errorCounter) {
+	lags := &lagCounter{}
 	var wg sync.WaitGroup
-	ch := make(chan string, nReqs+1)
-	for i := int64(1); i <= nReqs; i++ {
+	intended := time.Now()
+	for i := first; i <= nReqs; i++ {
 		wg.Add(1)
-		ia := p.next()
-		time.Sleep(time.Duration(ia) * time.Millisecond)
-		go func(id int64, wg *sync.WaitGroup, ch chan string) {
+		intended = intended.Add(time.Duration(p.next() * float64(time.Millisecond)))
+		time.Sleep(time.Until(intended))
+		go func(id int64, intended time.Time, wg *sync.WaitGroup) {
 			defer wg.Done()
 
-			status, responseTime, body, tsbefore, tsafter, err := sendReq(target)
-			if err != nil {
-				panic(err)
-			}
-			body, err = getValueFromBodyMessage(body)
-			if err != nil {
-				panic(err)
-			}
-
-			ch <- fmt.Sprintf("%d,%d,%d,%s,%d,%d", id, status, responseTime, body, tsbefore, tsafter)
+			r := measure(client, mix.choose(), fields, id, 0, intended)
+			errs.add(r.errClass)
+			lags.add(r)
+			output.add(r)
 
-			if status != 200 {
+			if r.status != 200 {
 				time.Sleep(10 * time.Millisecond)
 			}
 
-		}(i, &wg, ch)
+		}(i, intended, &wg)
 	}
 	wg.Wait()
-	chLen := len(ch)
-	for i := 1; i <= chLen; i++ {
-		output[i] = <-ch
+	lags.print()
+}
+
+// lateThreshold is the delay after the intended send time from which a request
+// is considered late, which means the workload could not keep up with its
+// schedule and latencies measured from the actual send time are optimistic.
+const lateThreshold = time.Millisecond
+
+// lagCounter keeps how late requests were sent. It is safe for concurrent use.
+type lagCounter struct {
+	mu     sync.Mutex
+	count  int
+	late   int
+	maxLag int64
+}
+
+func (l *lagCounter) add(r result) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lag := r.tsbefore - r.tsintended
+	l.count++
+	if lag > int64(lateThreshold) {
+		l.late++
 	}
-	close(ch)
-	return nil
+	if lag > l.maxLag {
+		l.maxLag = lag
+	}
+}
+
+func (l *lagCounter) print() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Printf("REQUESTS SENT LATE (more than %v after the intended time): %d of %d, MAX SEND LAG: %v\n", lateThreshold, l.late, l.count, time.Duration(l.maxLag))
+}
+
+// result packs the measurements of one request.
+type result struct {
+	id           int64
+	status       int
+	responseTime int64 // tsafter - tsbefore
+	body         string
+	tsbefore     int64 // when the request was actually sent
+	tsafter      int64
+	tsintended   int64 // when the request should have been sent according to the workload schedule
+	errClass     string
+	vu           int    // closed-loop virtual user that sent the request, zero on open-loop workloads
+	endpoint     string // name of the request mix endpoint
+	timings      timings
+	fields       []string // values extracted from the response body
+}
+
+const resultHeader = "id,status,response_time,body,tsbefore,tsafter,tsintended,intended_response_time,error,vu,endpoint," + timingsHeader
+
+func (r result) csvRow() string {
+	return fmt.Sprintf("%d,%d,%d,%s,%d,%d,%d,%d,%s,%d,%s,%s", r.id, r.status, r.responseTime, r.body, r.tsbefore, r.tsafter, r.tsintended, r.tsafter-r.tsintended, r.errClass, r.vu, r.endpoint, r.timings.csvFields()) + fieldsRow(r.fields)
+}
+
+func fieldsRow(fields []string) string {
+	if len(fields) == 0 {
+		return ""
+	}
+	return "," + strings.Join(fields, ",")
+}
+
+// measure sends one request and packs its measurements. A request that fails
+// is still measured, with its error class set and, if there is no response,
+// status zero. A zero intended time means the request was intended to be sent
+// right away, as in closed-loop workloads. The given fields are extracted from
+// the response body, and left empty if there is none.
+func measure(client *http.Client, e *endpoint, fields bodyFields, id int64, vu int, intended time.Time) result {
+	var r result
+	req, err := e.newRequest(id, vu)
+	if err == nil {
+		r, err = sendReq(client, req)
+	} else {
+		now := time.Now().UnixNano()
+		r.tsbefore, r.tsafter = now, now
+	}
+	r.id = id
+	r.vu = vu
+	r.endpoint = e.Name
+	r.tsintended = r.tsbefore
+	if !intended.IsZero() {
+		r.tsintended = intended.UnixNano()
+	}
+	r.fields = fields.extract(r.body)
+	if err != nil {
+		r.errClass = classifyError(err)
+		return r
+	}
+	msg, err := getValueFromBodyMessage(r.body)
+	if err != nil {
+		r.body = ""
+		r.errClass = errBadBody
+		return r
+	}
+	r.body = msg
+	return r
 }
 
 func getValueFromBodyMessage(body string) (string, error) {
@@ -152,40 +301,35 @@ func getValueFromBodyMessage(body string) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("Couldn't execute unmarshal of body (%s), error (%v)", body, err.Error())
 	}
-	msg := bodyMapped["message"].(string)
+	msg, ok := bodyMapped["message"].(string)
+	if !ok {
+		return "", fmt.Errorf("Body (%s) has no string message", body)
+	}
 	return msg, nil
 }
 
-func sendReq(target string) (int, int64, string, int64, int64, error) {
+func sendReq(client *http.Client, req *http.Request) (result, error) {
+	tracer := &timingsTracer{}
+	req = tracer.trace(req)
 	before := time.Now()
-	resp, err := http.Get(target)
+	resp, err := client.Do(req)
 	if err != nil {
-		return 0, 0, "", 0, 0, err
+		return result{tsbefore: before.UnixNano(), tsafter: time.Now().UnixNano(), timings: tracer.t}, err
 	}
 	defer resp.Body.Close()
 	after := time.Now()
-	bodyBytes, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return 0, 0, "", 0, 0, err
+	r := result{
+		status:   resp.StatusCode,
+		tsbefore: before.UnixNano(),
+		tsafter:  after.UnixNano(),
 	}
-	status := resp.StatusCode
-	body := string(bodyBytes)
-	tsbefore := before.UnixNano()
-	tsafter := after.UnixNano()
-	responseTime := tsafter - tsbefore
-	return status, responseTime, body, tsbefore, tsafter, nil
-}
-
-func createCsv(output []string, resultsPath, fileName string) error {
-	file, err := os.OpenFile(resultsPath+fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	r.responseTime = r.tsafter - r.tsbefore
+	bodyBytes, err := ioutil.ReadAll(resp.Body)
+	tracer.bodyRead()
+	r.timings = tracer.t
 	if err != nil {
-		return err
+		return r, err
 	}
-	datawriter := bufio.NewWriter(file)
-	for _, data := range output {
-		_, _ = datawriter.WriteString(data + "\n")
-	}
-	datawriter.Flush()
-	file.Close()
-	return nil
+	r.body = string(bodyBytes)
+	return r, nil
 }
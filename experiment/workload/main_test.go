@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type constantInterArrival float64
+
+func (c constantInterArrival) next() float64 { return float64(c) }
+
+// newTestServer returns a server answering every request with a JSON message
+// after the given delay.
+func newTestServer(delay time.Duration) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		w.Write([]byte(`{"message":"ok"}`))
+	}))
+}
+
+// newTestResultWriter returns a result writer of a new file in a temporary
+// directory, and the file path.
+func newTestResultWriter(t *testing.T) (*resultWriter, string) {
+	path := filepath.Join(t.TempDir(), "results")
+	rw, _, err := newResultWriter(path, resultHeader, false, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	return rw, path
+}
+
+// readResults returns the rows of a results file as column name to value maps.
+func readResults(t *testing.T, path string) []map[string]string {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	var rows []map[string]string
+	for _, record := range records[1:] {
+		row := make(map[string]string)
+		for i, name := range records[0] {
+			row[name] = record[i]
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func parseColumn(t *testing.T, row map[string]string, name string) int64 {
+	v, err := strconv.ParseInt(row[name], 10, 64)
+	if err != nil {
+		t.Fatalf("Unexpected error parsing %s: %q", name, err)
+	}
+	return v
+}
+
+func TestOpenLoopWorkload_IntendedTimes(t *testing.T) {
+	// The server is slower than the arrivals, so requests overlap and the
+	// schedule must not wait for the responses.
+	server := newTestServer(50 * time.Millisecond)
+	defer server.Close()
+	mix, err := singleEndpointMix(server.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	output, path := newTestResultWriter(t)
+	interval := 20 * time.Millisecond
+	openLoopWorkload(server.Client(), mix, nil, 1, 5, constantInterArrival(interval.Seconds()*1000), output, newErrorCounter())
+	if err := output.close(); err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+
+	rows := readResults(t, path)
+	if len(rows) != 5 {
+		t.Fatalf("Want: 5 rows, got: %d", len(rows))
+	}
+	first := parseColumn(t, rows[0], "tsintended")
+	for n, row := range rows {
+		// Intended times are exactly spaced by the inter-arrival, however late
+		// the scheduler wakes up.
+		if got := parseColumn(t, row, "tsintended") - first; got != int64(n)*int64(interval) {
+			t.Fatalf("Want: request %d intended %v after the first, got: %v", n+1, time.Duration(n)*interval, time.Duration(got))
+		}
+		if parseColumn(t, row, "tsbefore") < parseColumn(t, row, "tsintended") {
+			t.Fatalf("Want: request %d sent after its intended time", n+1)
+		}
+		if parseColumn(t, row, "intended_response_time") < parseColumn(t, row, "response_time") {
+			t.Fatalf("Want: request %d intended response time not smaller than its response time", n+1)
+		}
+	}
+	last := parseColumn(t, rows[4], "tsbefore") - parseColumn(t, rows[0], "tsbefore")
+	if last >= int64(4*interval+50*time.Millisecond) {
+		t.Fatalf("Want: arrivals not waiting for the responses, the last one was sent %v after the first", time.Duration(last))
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"golang.org/x/exp/rand"
+)
+
+// endpoint is one entry of a request mix file. The body is a text/template
+// executed for every request with the fields of bodyData, e.g.
+// {"id": {{.ID}}, "scale": 0.5}. An endpoint without weight has weight 1, and
+// one with weight 0 is disabled.
+type endpoint struct {
+	Name    string            `json:"name"`
+	URL     string            `json:"url"`
+	Method  string            `json:"method"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+	Weight  *float64          `json:"weight"`
+
+	body *template.Template
+}
+
+// bodyData is the data available to the body templates.
+type bodyData struct {
+	ID       int64  // id of the request
+	VU       int    // closed-loop virtual user sending the request, zero on open-loop workloads
+	Endpoint string // name of the endpoint
+}
+
+func (e *endpoint) newRequest(id int64, vu int) (*http.Request, error) {
+	var body io.Reader
+	if e.body != nil {
+		var buf bytes.Buffer
+		if err := e.body.Execute(&buf, bodyData{ID: id, VU: vu, Endpoint: e.Name}); err != nil {
+			return nil, err
+		}
+		body = &buf
+	}
+	req, err := http.NewRequest(e.Method, e.URL, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range e.Headers {
+		req.Header.Set(k, v)
+	}
+	return req, nil
+}
+
+// requestMix chooses the endpoint of each request according to the endpoints
+// weights. It is safe for concurrent use.
+type requestMix struct {
+	endpoints []*endpoint
+	cumWeight []float64
+	mu        sync.Mutex
+	rnd       *rand.Rand
+}
+
+// singleEndpointMix is the mix used when no mix file is given: GET requests to
+// the target.
+func singleEndpointMix(target string) (*requestMix, error) {
+	return newRequestMix([]*endpoint{{Name: "default", URL: target}})
+}
+
+func readRequestMix(path string) (*requestMix, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the request mix file: %v", err)
+	}
+	var endpoints []*endpoint
+	if err := json.Unmarshal(b, &endpoints); err != nil {
+		return nil, fmt.Errorf("malformed request mix file %s: %v", path, err)
+	}
+	return newRequestMix(endpoints)
+}
+
+func newRequestMix(endpoints []*endpoint) (*requestMix, error) {
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("the request mix must have at least one endpoint")
+	}
+	m := &requestMix{rnd: rand.New(rand.NewSource(uint64(time.Now().UnixNano())))}
+	names := make(map[string]bool)
+	var total float64
+	for i, e := range endpoints {
+		if e.Name == "" {
+			e.Name = fmt.Sprintf("endpoint%d", i+1)
+		}
+		if names[e.Name] {
+			return nil, fmt.Errorf("endpoint name %s is repeated", e.Name)
+		}
+		names[e.Name] = true
+		if e.URL == "" {
+			return nil, fmt.Errorf("endpoint %s has no url", e.Name)
+		}
+		if e.Method == "" {
+			e.Method = http.MethodGet
+		}
+		e.Method = strings.ToUpper(e.Method)
+		weight := 1.0
+		if e.Weight != nil {
+			weight = *e.Weight
+		}
+		if weight < 0 {
+			return nil, fmt.Errorf("endpoint %s has negative weight %f", e.Name, weight)
+		}
+		if e.Body != "" {
+			t, err := template.New(e.Name).Parse(e.Body)
+			if err != nil {
+				return nil, fmt.Errorf("endpoint %s has an invalid body template: %v", e.Name, err)
+			}
+			e.body = t
+		}
+		total += weight
+		m.endpoints = append(m.endpoints, e)
+		m.cumWeight = append(m.cumWeight, total)
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("the request mix must have at least one endpoint with weight bigger than zero")
+	}
+	return m, nil
+}
+
+func (m *requestMix) choose() *endpoint {
+	if len(m.endpoints) == 1 {
+		return m.endpoints[0]
+	}
+	m.mu.Lock()
+	x := m.rnd.Float64() * m.cumWeight[len(m.cumWeight)-1]
+	m.mu.Unlock()
+	for i, w := range m.cumWeight {
+		if x < w {
+			return m.endpoints[i]
+		}
+	}
+	return m.endpoints[len(m.endpoints)-1]
+}
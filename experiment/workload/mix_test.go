@@ -0,0 +1,105 @@
+package main
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/exp/rand"
+)
+
+func TestReadRequestMix(t *testing.T) {
+	var testData = []struct {
+		desc      string
+		mix       string
+		wantCum   []float64
+		wantNames []string
+		wantErr   bool
+	}{
+		{"DefaultWeight", `[{"url": "http://a"}, {"name": "b", "url": "http://b", "weight": 3}]`, []float64{1, 4}, []string{"endpoint1", "b"}, false},
+		{"ZeroWeightDisabled", `[{"name": "a", "url": "http://a", "weight": 0}, {"name": "b", "url": "http://b"}]`, []float64{0, 1}, []string{"a", "b"}, false},
+		{"NegativeWeight", `[{"name": "a", "url": "http://a", "weight": -1}]`, nil, nil, true},
+		{"AllZero", `[{"name": "a", "url": "http://a", "weight": 0}, {"name": "b", "url": "http://b", "weight": 0}]`, nil, nil, true},
+		{"Empty", `[]`, nil, nil, true},
+		{"RepeatedName", `[{"name": "a", "url": "http://a"}, {"name": "a", "url": "http://b"}]`, nil, nil, true},
+		{"NoURL", `[{"name": "a"}]`, nil, nil, true},
+		{"InvalidBody", `[{"name": "a", "url": "http://a", "body": "{{.ID"}]`, nil, nil, true},
+		{"Malformed", `{"name": "a"}`, nil, nil, true},
+	}
+	for _, d := range testData {
+		t.Run(d.desc, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "mix.json")
+			if err := os.WriteFile(path, []byte(d.mix), 0644); err != nil {
+				t.Fatalf("Unexpected error: %q", err)
+			}
+			m, err := readRequestMix(path)
+			if (err != nil) != d.wantErr {
+				t.Fatalf("Want error: %v, got: %v", d.wantErr, err)
+			}
+			if d.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(m.cumWeight, d.wantCum) {
+				t.Fatalf("Want: cumulative weights %v, got: %v", d.wantCum, m.cumWeight)
+			}
+			var names []string
+			for _, e := range m.endpoints {
+				names = append(names, e.Name)
+			}
+			if !reflect.DeepEqual(names, d.wantNames) {
+				t.Fatalf("Want: endpoints %v, got: %v", d.wantNames, names)
+			}
+		})
+	}
+	if _, err := readRequestMix(filepath.Join(os.TempDir(), "missing-mix.json")); err == nil {
+		t.Fatalf("Want error reading a missing mix file")
+	}
+}
+
+func TestRequestMixChoose(t *testing.T) {
+	weight := func(w float64) *float64 { return &w }
+	m, err := newRequestMix([]*endpoint{
+		{Name: "a", URL: "http://a", Weight: weight(1)},
+		{Name: "disabled", URL: "http://disabled", Weight: weight(0)},
+		{Name: "b", URL: "http://b", Weight: weight(3)},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	m.rnd = rand.New(rand.NewSource(1))
+	counts := make(map[string]int)
+	n := 10000
+	for i := 0; i < n; i++ {
+		counts[m.choose().Name]++
+	}
+	if counts["disabled"] != 0 {
+		t.Fatalf("Want: the endpoint with weight 0 never chosen, got: %d", counts["disabled"])
+	}
+	if got := float64(counts["b"]) / float64(n); math.Abs(got-0.75) > 0.02 {
+		t.Fatalf("Want: b chosen 75%% of the times, got: %v", got)
+	}
+}
+
+func TestEndpointNewRequest(t *testing.T) {
+	m, err := newRequestMix([]*endpoint{{Name: "a", URL: "http://a", Method: "post", Headers: map[string]string{"X-Test": "1"}, Body: `{"id": {{.ID}}, "vu": {{.VU}}, "endpoint": "{{.Endpoint}}"}`}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	req, err := m.choose().newRequest(7, 2)
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	if want := `{"id": 7, "vu": 2, "endpoint": "a"}`; string(body) != want {
+		t.Fatalf("Want: %s, got: %s", want, body)
+	}
+	if req.Method != "POST" || req.Header.Get("X-Test") != "1" {
+		t.Fatalf("Want: POST with the X-Test header, got: %s %v", req.Method, req.Header)
+	}
+}
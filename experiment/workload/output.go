@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// checkpointEvery is the number of rows written between two checkpoints.
+const checkpointEvery = 100
+
+// resultWriter streams the results to the CSV file as they complete. Rows are
+// written in id order, so results that complete out of order wait for the
+// previous ones. Every checkpointEvery rows the file is synced and a checkpoint
+// with the last written id and the file size is saved next to it, which lets a
+// crashed workload be resumed from that row. It is safe for concurrent use.
+type resultWriter struct {
+	path    string
+	f       *os.File
+	w       *bufio.Writer
+	offset  int64 // file size after the last written row
+	next    int64 // id of the next row to be written
+	pending map[int64]result
+	results chan result
+	done    chan struct{}
+	err     error
+}
+
+// newResultWriter opens the results file and returns the id of the first
+// request to be made. An existing file is only appended to if appendRes is set,
+// and it is only resumed, dropping the rows written after the last checkpoint,
+// if resume is set.
+func newResultWriter(path, header string, appendRes, resume bool) (*resultWriter, int64, error) {
+	rw := &resultWriter{
+		path:    path,
+		next:    1,
+		pending: make(map[int64]result),
+		results: make(chan result, checkpointEvery),
+		done:    make(chan struct{}),
+	}
+	var err error
+	switch {
+	case resume:
+		var last int64
+		last, rw.offset, err = readCheckpoint(checkpointPath(path))
+		if err != nil {
+			return nil, 0, err
+		}
+		rw.next = last + 1
+		if rw.f, err = os.OpenFile(path, os.O_WRONLY, 0644); err != nil {
+			return nil, 0, err
+		}
+		// Drops rows that were written but not checkpointed.
+		if err = rw.f.Truncate(rw.offset); err != nil {
+			return nil, 0, err
+		}
+		if _, err = rw.f.Seek(rw.offset, 0); err != nil {
+			return nil, 0, err
+		}
+	case appendRes:
+		if rw.f, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err != nil {
+			return nil, 0, err
+		}
+		if rw.offset, err = rw.f.Seek(0, 2); err != nil {
+			return nil, 0, err
+		}
+	default:
+		if rw.f, err = os.OpenFile(path, os.O_EXCL|os.O_CREATE|os.O_WRONLY, 0644); err != nil {
+			if os.IsExist(err) {
+				return nil, 0, fmt.Errorf("results file %s already exists, use -append to add rows to it or -resume to continue a crashed workload", path)
+			}
+			return nil, 0, err
+		}
+	}
+	rw.w = bufio.NewWriter(rw.f)
+	if rw.offset == 0 {
+		if err := rw.writeLine(header); err != nil {
+			return nil, 0, err
+		}
+	}
+	// Checkpoints before any request, so a workload that crashes early can also be resumed.
+	if rw.checkpoint(); rw.err != nil {
+		return nil, 0, rw.err
+	}
+	go rw.loop()
+	return rw, rw.next, nil
+}
+
+func (rw *resultWriter) add(r result) {
+	rw.results <- r
+}
+
+func (rw *resultWriter) loop() {
+	defer close(rw.done)
+	written := 0
+	for r := range rw.results {
+		rw.pending[r.id] = r
+		for {
+			r, ok := rw.pending[rw.next]
+			if !ok {
+				break
+			}
+			delete(rw.pending, rw.next)
+			rw.write(r)
+			written++
+			if written%checkpointEvery == 0 {
+				rw.checkpoint()
+			}
+		}
+	}
+}
+
+func (rw *resultWriter) write(r result) {
+	if rw.err != nil {
+		return
+	}
+	if rw.err = rw.writeLine(r.csvRow()); rw.err == nil {
+		rw.next = r.id + 1
+	}
+}
+
+func (rw *resultWriter) writeLine(s string) error {
+	n, err := rw.w.WriteString(s + "\n")
+	rw.offset += int64(n)
+	return err
+}
+
+// checkpoint syncs the results file and then atomically replaces the checkpoint.
+func (rw *resultWriter) checkpoint() {
+	if rw.err != nil {
+		return
+	}
+	if rw.err = rw.w.Flush(); rw.err != nil {
+		return
+	}
+	if rw.err = rw.f.Sync(); rw.err != nil {
+		return
+	}
+	rw.err = writeCheckpoint(checkpointPath(rw.path), rw.next-1, rw.offset)
+}
+
+// close waits for the pending results, writes them and closes the file. The
+// checkpoint is removed once every result is safely written.
+func (rw *resultWriter) close() error {
+	close(rw.results)
+	<-rw.done
+	if len(rw.pending) > 0 && rw.err == nil {
+		rw.err = fmt.Errorf("%d results were not written, the first missing id is %d", len(rw.pending), rw.next)
+	}
+	rw.checkpoint()
+	if err := rw.f.Close(); rw.err == nil {
+		rw.err = err
+	}
+	if rw.err != nil {
+		return rw.err
+	}
+	return os.Remove(checkpointPath(rw.path))
+}
+
+func checkpointPath(path string) string {
+	return path + ".checkpoint"
+}
+
+// writeCheckpoint saves the last written id and the results file size.
+func writeCheckpoint(path string, last, offset int64) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(f, "%d,%d\n", last, offset); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func readCheckpoint(path string) (int64, int64, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, 0, fmt.Errorf("could not read the checkpoint to resume from: %v", err)
+	}
+	fields := strings.Split(strings.TrimSpace(string(b)), ",")
+	if len(fields) != 2 {
+		return 0, 0, fmt.Errorf("malformed checkpoint %s: %q", path, b)
+	}
+	last, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("malformed checkpoint id %s: %v", path, err)
+	}
+	offset, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("malformed checkpoint offset %s: %v", path, err)
+	}
+	return last, offset, nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestResultWriter_Resume(t *testing.T) {
+	rows := make([]string, 4)
+	for n := range rows {
+		rows[n] = result{id: int64(n + 1), status: 200, body: "ok"}.csvRow() + "\n"
+	}
+	// offset returns the file size after the header and the first n rows.
+	offset := func(n int) int64 {
+		return int64(len(resultHeader+"\n") + len(strings.Join(rows[:n], "")))
+	}
+	var testData = []struct {
+		desc       string
+		content    string
+		checkpoint string // missing if empty
+		wantFirst  int64
+		wantErr    bool
+	}{
+		{"TruncatedLastLine", resultHeader + "\n" + strings.Join(rows[:3], "") + rows[3][:10], "3," + strconv.FormatInt(offset(3), 10), 4, false},
+		{"RowsAfterCheckpoint", resultHeader + "\n" + strings.Join(rows[:3], ""), "2," + strconv.FormatInt(offset(2), 10), 3, false},
+		{"OnlyHeader", resultHeader + "\n", "0," + strconv.FormatInt(offset(0), 10), 1, false},
+		{"MissingCheckpoint", resultHeader + "\n" + strings.Join(rows[:3], ""), "", 0, true},
+		{"MalformedCheckpoint", resultHeader + "\n" + strings.Join(rows[:3], ""), "3", 0, true},
+	}
+	for _, d := range testData {
+		t.Run(d.desc, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "results")
+			if err := os.WriteFile(path, []byte(d.content), 0644); err != nil {
+				t.Fatalf("Unexpected error: %q", err)
+			}
+			if d.checkpoint != "" {
+				if err := os.WriteFile(checkpointPath(path), []byte(d.checkpoint+"\n"), 0644); err != nil {
+					t.Fatalf("Unexpected error: %q", err)
+				}
+			}
+			rw, first, err := newResultWriter(path, resultHeader, false, true)
+			if (err != nil) != d.wantErr {
+				t.Fatalf("Want error: %v, got: %v", d.wantErr, err)
+			}
+			if d.wantErr {
+				return
+			}
+			if first != d.wantFirst {
+				t.Fatalf("Want: resume from %d, got: %d", d.wantFirst, first)
+			}
+			// Results completing out of order are still written in id order.
+			for id := int64(5); id >= first; id-- {
+				rw.add(result{id: id, status: 200, body: "ok"})
+			}
+			if err := rw.close(); err != nil {
+				t.Fatalf("Unexpected error: %q", err)
+			}
+			got := readResults(t, path)
+			if len(got) != 5 {
+				t.Fatalf("Want: 5 rows, got: %d", len(got))
+			}
+			for n, row := range got {
+				if id := parseColumn(t, row, "id"); id != int64(n+1) {
+					t.Fatalf("Want: id %d in row %d, got: %d", n+1, n+1, id)
+				}
+			}
+			if _, err := os.Stat(checkpointPath(path)); !os.IsNotExist(err) {
+				t.Fatalf("Want: checkpoint removed after closing, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestResultWriter_Checkpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results")
+	rw, first, err := newResultWriter(path, resultHeader, false, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	for id := first; id <= checkpointEvery+10; id++ {
+		rw.add(result{id: id, status: 200, body: "ok"})
+	}
+	// Stops the writer without closing it, as a crash after the rows were
+	// written would.
+	close(rw.results)
+	<-rw.done
+	rw.w.Flush()
+
+	last, offset, err := readCheckpoint(checkpointPath(path))
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	if last != checkpointEvery {
+		t.Fatalf("Want: checkpoint at %d, got: %d", checkpointEvery, last)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	if lines := strings.Count(string(b[:offset]), "\n"); lines != checkpointEvery+1 {
+		t.Fatalf("Want: checkpoint offset after %d lines, got: %d", checkpointEvery+1, lines)
+	}
+	rw.f.Close()
+}
+
+func TestResultWriter_ExistingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results")
+	if err := os.WriteFile(path, []byte(resultHeader+"\n"), 0644); err != nil {
+		t.Fatalf("Unexpected error: %q", err)
+	}
+	if _, _, err := newResultWriter(path, resultHeader, false, false); err == nil {
+		t.Fatalf("Want error overwriting an existing results file")
+	}
+}
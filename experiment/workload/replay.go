@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// readArrivalTrace reads the arrival times of a measurement CSV (tsbefore
+// column, in nanoseconds) or of a simulator requests CSV (created_time column,
+// in seconds) and returns them as offsets from the first arrival, in arrival
+// order, multiplied by scale.
+func readArrivalTrace(path string, scale float64) ([]time.Duration, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open the replay trace: %v", err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("error parsing the replay trace (%s): %v", path, err)
+	}
+	if len(records) <= 1 {
+		return nil, fmt.Errorf("the replay trace %s has no arrivals", path)
+	}
+	col, unit := -1, 0.0
+	for i, name := range records[0] {
+		switch name {
+		case "tsbefore":
+			col, unit = i, 1
+		case "created_time":
+			col, unit = i, float64(time.Second)
+		}
+		if col >= 0 {
+			break
+		}
+	}
+	if col < 0 {
+		return nil, fmt.Errorf("the replay trace %s has neither a tsbefore nor a created_time column", path)
+	}
+	arrivals := make([]float64, 0, len(records)-1)
+	for _, row := range records[1:] {
+		v, err := strconv.ParseFloat(row[col], 64)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %s in row (%v) of the replay trace: %v", records[0][col], row, err)
+		}
+		arrivals = append(arrivals, v*unit)
+	}
+	// Measurement rows are not necessarily in arrival order.
+	sort.Float64s(arrivals)
+	offsets := make([]time.Duration, len(arrivals))
+	for i, a := range arrivals {
+		offsets[i] = time.Duration(math.Round((a - arrivals[0]) * scale))
+	}
+	return offsets, nil
+}
+
+// replayInterArrival replays the inter-arrival times of a trace.
+type replayInterArrival struct {
+	offsets []time.Duration
+	index   int
+	started bool
+}
+
+// NewReplayInterArrival creates the inter-arrival times that send the requests
+// at the trace offsets. When resuming from request first, the previous
+// arrivals are skipped and the request first is sent right away.
+func NewReplayInterArrival(offsets []time.Duration, first int64) InterArrival {
+	return &replayInterArrival{offsets: offsets, index: int(first - 1)}
+}
+
+func (r *replayInterArrival) next() float64 {
+	var gap time.Duration
+	if r.started && r.index < len(r.offsets) {
+		gap = r.offsets[r.index] - r.offsets[r.index-1]
+	}
+	r.started = true
+	r.index++
+	return float64(gap) / float64(time.Millisecond)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReadArrivalTrace(t *testing.T) {
+	var testData = []struct {
+		desc    string
+		trace   string
+		scale   float64
+		want    []time.Duration
+		wantErr bool
+	}{
+		{"Measurement", "id,status,tsbefore\n1,200,1000000000\n3,200,1030000000\n2,200,1010000000\n", 1, []time.Duration{0, 10 * time.Millisecond, 30 * time.Millisecond}, false},
+		{"Simulator", "id,created_time\n0,0.5\n1,0.75\n", 1, []time.Duration{0, 250 * time.Millisecond}, false},
+		{"Scaled", "id,created_time\n0,0.5\n1,0.75\n", 2, []time.Duration{0, 500 * time.Millisecond}, false},
+		{"NoArrivals", "id,tsbefore\n", 1, nil, true},
+		{"NoColumn", "id,status\n1,200\n", 1, nil, true},
+		{"Malformed", "id,tsbefore\n1,foo\n", 1, nil, true},
+	}
+	for _, d := range testData {
+		t.Run(d.desc, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "trace.csv")
+			if err := os.WriteFile(path, []byte(d.trace), 0644); err != nil {
+				t.Fatalf("Unexpected error: %q", err)
+			}
+			got, err := readArrivalTrace(path, d.scale)
+			if (err != nil) != d.wantErr {
+				t.Fatalf("Want error: %v, got: %v", d.wantErr, err)
+			}
+			if !reflect.DeepEqual(got, d.want) {
+				t.Fatalf("Want: %v, got: %v", d.want, got)
+			}
+		})
+	}
+}
+
+func TestReplayInterArrival(t *testing.T) {
+	offsets := []time.Duration{0, 10 * time.Millisecond, 30 * time.Millisecond, 60 * time.Millisecond}
+	var testData = []struct {
+		desc  string
+		first int64
+		want  []float64 // in milliseconds
+	}{
+		{"FromStart", 1, []float64{0, 10, 20, 30}},
+		{"Resumed", 3, []float64{0, 30}},
+	}
+	for _, d := range testData {
+		t.Run(d.desc, func(t *testing.T) {
+			ia := NewReplayInterArrival(offsets, d.first)
+			var got []float64
+			for range d.want {
+				got = append(got, ia.next())
+			}
+			if !reflect.DeepEqual(got, d.want) {
+				t.Fatalf("Want: %v, got: %v", d.want, got)
+			}
+			// Past the end of the trace requests are sent right away.
+			if got := ia.next(); got != 0 {
+				t.Fatalf("Want: 0 past the end of the trace, got: %v", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"time"
+)
+
+// timings is the client-side breakdown of one request, in nanoseconds, so the
+// network overhead can be told apart from the function execution. Phases that
+// did not happen, like the connection set up of a reused connection, are zero.
+type timings struct {
+	dns      int64 // name resolution
+	connect  int64 // TCP connect
+	tls      int64 // TLS handshake
+	ttfb     int64 // from the request being written to the first response byte
+	transfer int64 // from the first response byte to the end of the body
+	reused   bool  // whether the request went over a connection already open
+}
+
+const timingsHeader = "dns,connect,tls,ttfb,transfer,conn_reused"
+
+func (t timings) csvFields() string {
+	return fmt.Sprintf("%d,%d,%d,%d,%d,%t", t.dns, t.connect, t.tls, t.ttfb, t.transfer, t.reused)
+}
+
+// timingsTracer collects the timings of one request through httptrace hooks.
+type timingsTracer struct {
+	t                                timings
+	dnsStart, connectStart, tlsStart time.Time
+	wroteRequest, firstByte          time.Time
+}
+
+// trace returns the request with the tracer hooks attached.
+func (tr *timingsTracer) trace(req *http.Request) *http.Request {
+	ct := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { tr.dnsStart = time.Now() },
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			tr.t.dns = time.Since(tr.dnsStart).Nanoseconds()
+		},
+		ConnectStart: func(string, string) { tr.connectStart = time.Now() },
+		ConnectDone: func(string, string, error) {
+			tr.t.connect = time.Since(tr.connectStart).Nanoseconds()
+		},
+		TLSHandshakeStart: func() { tr.tlsStart = time.Now() },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			tr.t.tls = time.Since(tr.tlsStart).Nanoseconds()
+		},
+		GotConn: func(info httptrace.GotConnInfo) { tr.t.reused = info.Reused },
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			tr.wroteRequest = time.Now()
+		},
+		GotFirstResponseByte: func() {
+			tr.firstByte = time.Now()
+			if !tr.wroteRequest.IsZero() {
+				tr.t.ttfb = tr.firstByte.Sub(tr.wroteRequest).Nanoseconds()
+			}
+		},
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), ct))
+}
+
+// bodyRead records the end of the body transfer.
+func (tr *timingsTracer) bodyRead() {
+	if !tr.firstByte.IsZero() {
+		tr.t.transfer = time.Since(tr.firstByte).Nanoseconds()
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTimingsCSVFields(t *testing.T) {
+	got := timings{dns: 1, connect: 2, tls: 3, ttfb: 4, transfer: 5, reused: true}.csvFields()
+	if want := "1,2,3,4,5,true"; got != want {
+		t.Fatalf("Want: %s, got: %s", want, got)
+	}
+}
+
+func TestSendReq_Timings(t *testing.T) {
+	delay := 20 * time.Millisecond
+	plain := newTestServer(delay)
+	defer plain.Close()
+	secure := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		w.Write([]byte(`{"message":"ok"}`))
+	}))
+	defer secure.Close()
+	var testData = []struct {
+		desc    string
+		server  *httptest.Server
+		wantTLS bool
+	}{
+		{"HTTP", plain, false},
+		{"HTTPS", secure, true},
+	}
+	for _, d := range testData {
+		t.Run(d.desc, func(t *testing.T) {
+			client := d.server.Client()
+			for n, reused := range []bool{false, true} {
+				req, err := http.NewRequest(http.MethodGet, d.server.URL, nil)
+				if err != nil {
+					t.Fatalf("Unexpected error: %q", err)
+				}
+				r, err := sendReq(client, req)
+				if err != nil {
+					t.Fatalf("Unexpected error: %q", err)
+				}
+				got := r.timings
+				if got.reused != reused {
+					t.Fatalf("Want: connection reused %v on request %d, got: %+v", reused, n+1, got)
+				}
+				// Only a new connection is set up, and the test servers are
+				// reached by IP, so there is no name resolution.
+				if got.dns != 0 || (got.connect > 0) == reused || (got.tls > 0) != (d.wantTLS && !reused) {
+					t.Fatalf("Unexpected set up timings on request %d: %+v", n+1, got)
+				}
+				// The function execution is part of the time to first byte.
+				if got.ttfb < int64(delay) || got.ttfb > r.responseTime || got.transfer < 0 {
+					t.Fatalf("Want: time to first byte between %v and %v, got: %+v", delay, time.Duration(r.responseTime), got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+// Synthetic function whose service time, allocation rate and heap threshold
+// are configurable. It reproduces, without the cloud, the behaviour of the
+// measured Java function behind GCI: requests allocate memory which is retained
+// until the heap reaches the threshold, then the function becomes unavailable
+// while it collects the garbage and sheds requests with 503.
+//
+// The response body is a JSON object whose message is, on success, the service
+// time in nanoseconds, like the Java handler. The request that triggers the
+// collection is answered only when the unavailability window ends, so its
+// tsbefore and tsafter measured by the workload span the window, and its
+// message is the list of shed response times in nanoseconds separated by ':',
+// the first one being its own, as the simulator instances read from 503
+// entries.
+// Requests arriving during the window are shed right away.
+//
+// It listens on the port given by the PORT environment variable, so it can be
+// used as a worker of the faas-emulator, or on the port flag.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	port              = flag.String("port", "8080", "port to listen on when the PORT environment variable is not set")
+	serviceTime       = flag.Duration("service_time", 20*time.Millisecond, "mean service time of the requests")
+	serviceTimeStdDev = flag.Duration("service_time_stddev", 5*time.Millisecond, "standard deviation of the service time of the requests")
+	allocRate         = flag.Float64("alloc_rate", 100, "memory allocated and retained by the requests, in MB per second of service time")
+	heapThreshold     = flag.Float64("heap_threshold", 64, "retained heap, in MB, that triggers a collection and its unavailability window")
+	gcPausePerMB      = flag.Duration("gc_pause_per_mb", time.Millisecond, "pause added to the collection for each MB of retained heap, which models a stop-the-world collection on top of the Go one")
+	initTime          = flag.Duration("init_time", 0, "initialization time before the function starts listening")
+)
+
+const mb = 1 << 20
+
+func main() {
+	flag.Parse()
+	if *serviceTime < 0 || *serviceTimeStdDev < 0 || *allocRate < 0 || *heapThreshold <= 0 || *gcPausePerMB < 0 {
+		log.Fatalf("invalid flags: durations and the allocation rate can not be negative and the heap threshold must be bigger than zero")
+	}
+	addr := ":" + *port
+	if p := os.Getenv("PORT"); p != "" {
+		addr = ":" + p
+	}
+	time.Sleep(*initTime)
+
+	rand.Seed(time.Now().UnixNano())
+	f := &function{
+		serviceTime:       *serviceTime,
+		serviceTimeStdDev: *serviceTimeStdDev,
+		bytesPerSecond:    *allocRate * mb,
+		threshold:         int64(*heapThreshold * mb),
+		pausePerMB:        *gcPausePerMB,
+	}
+	fmt.Printf("FUNCTION LISTENING ON %s\n", addr)
+	log.Fatal(http.ListenAndServe(addr, f))
+}
+
+type function struct {
+	serviceTime       time.Duration
+	serviceTimeStdDev time.Duration
+	bytesPerSecond    float64
+	threshold         int64
+	pausePerMB        time.Duration
+
+	mu         sync.Mutex
+	heap       [][]byte // memory retained by the requests until the next collection
+	heapBytes  int64
+	collecting bool
+	shedTimes  []int64 // response times, in nanoseconds, of the requests shed on the current window
+}
+
+func (f *function) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	before := time.Now()
+	f.mu.Lock()
+	if f.collecting {
+		// Shed while unavailable, the request only pays the shedding decision.
+		rt := time.Since(before).Nanoseconds()
+		f.shedTimes = append(f.shedTimes, rt)
+		f.mu.Unlock()
+		writeResponse(rw, http.StatusServiceUnavailable, map[string]interface{}{
+			"message": strconv.FormatInt(rt, 10),
+		})
+		return
+	}
+	if f.heapBytes >= f.threshold {
+		f.collecting = true
+		f.shedTimes = []int64{time.Since(before).Nanoseconds()}
+		heapBytes := f.heapBytes
+		f.mu.Unlock()
+
+		gcTime := f.collect(heapBytes)
+
+		f.mu.Lock()
+		msg := formatShedTimes(f.shedTimes)
+		f.collecting = false
+		f.mu.Unlock()
+		writeResponse(rw, http.StatusServiceUnavailable, map[string]interface{}{
+			"message":    msg,
+			"gc_time_ns": gcTime.Nanoseconds(),
+			"heap_bytes": heapBytes,
+		})
+		return
+	}
+	f.mu.Unlock()
+
+	st := time.Duration(rand.NormFloat64()*float64(f.serviceTimeStdDev)) + f.serviceTime
+	if st < 0 {
+		st = 0
+	}
+	f.allocate(int64(f.bytesPerSecond * st.Seconds()))
+	time.Sleep(st - time.Since(before))
+
+	f.mu.Lock()
+	heapBytes := f.heapBytes
+	f.mu.Unlock()
+	writeResponse(rw, http.StatusOK, map[string]interface{}{
+		"message":    strconv.FormatInt(time.Since(before).Nanoseconds(), 10),
+		"heap_bytes": heapBytes,
+	})
+}
+
+// allocate retains n bytes, touching every page so the memory is actually
+// committed.
+func (f *function) allocate(n int64) {
+	if n <= 0 {
+		return
+	}
+	b := make([]byte, n)
+	for i := 0; i < len(b); i += 4096 {
+		b[i] = 1
+	}
+	f.mu.Lock()
+	f.heap = append(f.heap, b)
+	f.heapBytes += n
+	f.mu.Unlock()
+}
+
+// collect releases the retained memory, runs the Go collector and pauses
+// proportionally to the heap size. It returns the duration of the collection.
+func (f *function) collect(heapBytes int64) time.Duration {
+	before := time.Now()
+	f.mu.Lock()
+	f.heap = nil
+	f.heapBytes = 0
+	f.mu.Unlock()
+	runtime.GC()
+	time.Sleep(time.Duration(float64(heapBytes) / mb * float64(f.pausePerMB)))
+	return time.Since(before)
+}
+
+func formatShedTimes(rts []int64) string {
+	s := make([]string, len(rts))
+	for i, rt := range rts {
+		s[i] = strconv.FormatInt(rt, 10)
+	}
+	return strings.Join(s, ":")
+}
+
+func writeResponse(rw http.ResponseWriter, status int, body map[string]interface{}) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	rw.Write(b)
+}
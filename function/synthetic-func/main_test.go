@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// simulatorShedTimes parses the message of a 503 response as the simulator
+// instances do with the body of 503 entries (dealWithTruncatedInput and
+// nextShed of experiment/faas-simulator/sim/instance.go): the times after the
+// first one, which is the request own, are nanoseconds.
+func simulatorShedTimes(t *testing.T, msg string) []float64 {
+	var seconds []float64
+	for _, rt := range strings.Split(msg, ":")[1:] {
+		if _, err := strconv.ParseInt(rt, 10, 64); err != nil {
+			t.Fatalf("Want: integer nanoseconds, got: %s", rt)
+		}
+		ns, err := strconv.ParseFloat(rt, 64)
+		if err != nil {
+			t.Fatalf("Unexpected error: %q", err)
+		}
+		seconds = append(seconds, ns/1000000000)
+	}
+	return seconds
+}
+
+func TestFormatShedTimes(t *testing.T) {
+	msg := formatShedTimes([]int64{1500000, 20000, 3000})
+	if msg != "1500000:20000:3000" {
+		t.Fatalf("Want: 1500000:20000:3000, got: %s", msg)
+	}
+	want := []float64{0.00002, 0.000003}
+	got := simulatorShedTimes(t, msg)
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("Want: %v, got: %v", want, got)
+	}
+}
+
+func TestServeHTTP_Collection(t *testing.T) {
+	f := &function{
+		serviceTime:    0,
+		bytesPerSecond: mb,
+		threshold:      1,
+		pausePerMB:     time.Second,
+	}
+	f.heapBytes = 100 * 1024 // the collection pauses 100ms
+	server := httptest.NewServer(f)
+	defer server.Close()
+
+	type response struct {
+		status int
+		msg    string
+	}
+	get := func() response {
+		resp, err := http.Get(server.URL)
+		if err != nil {
+			t.Errorf("Unexpected error: %q", err)
+			return response{}
+		}
+		defer resp.Body.Close()
+		var body map[string]interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Errorf("Unexpected error: %q", err)
+		}
+		msg, _ := body["message"].(string)
+		return response{resp.StatusCode, msg}
+	}
+	var collecting response
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		collecting = get()
+	}()
+	time.Sleep(20 * time.Millisecond)
+	shed := get()
+	wg.Wait()
+
+	if shed.status != http.StatusServiceUnavailable || collecting.status != http.StatusServiceUnavailable {
+		t.Fatalf("Want: 503 responses, got: %d and %d", collecting.status, shed.status)
+	}
+	if _, err := strconv.ParseInt(shed.msg, 10, 64); err != nil {
+		t.Fatalf("Want: the shed response time in integer nanoseconds, got: %s", shed.msg)
+	}
+	// The request shed during the collection only paid the shedding decision,
+	// much less than the collection itself.
+	got := simulatorShedTimes(t, collecting.msg)
+	if len(got) != 1 || got[0] <= 0 || got[0] >= 0.1 {
+		t.Fatalf("Want: 1 shed time between 0 and 0.1 seconds, got: %v (message %s)", got, collecting.msg)
+	}
+	if ok := get(); ok.status != http.StatusOK {
+		t.Fatalf("Want: 200 after the collection, got: %d", ok.status)
+	}
+}